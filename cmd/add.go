@@ -2,20 +2,30 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
 
+	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"github.com/user-cube/auth-refresher/pkg/auth"
 	"github.com/user-cube/auth-refresher/pkg/ui"
-	"gopkg.in/yaml.v3"
 )
 
 var addCmd = &cobra.Command{
 	Use:   "add",
 	Short: "Add a new registry",
+	Long: `Add a registry to the configuration file, prompting for its name, its type and
+the fields that type needs. Secrets are asked at login time.
+
+Tags and groups are optional. Both select registries in login, logout, list and
+status: tags are free-form labels stored on the registry (e.g. project-x,
+staging), groups are named sets of registries stored in the groups section of
+the configuration.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Setup signal handling for graceful exit
 		c := make(chan os.Signal, 1)
@@ -28,92 +38,120 @@ var addCmd = &cobra.Command{
 			os.Exit(0)
 		}()
 
-		configPath := filepath.Join(os.Getenv("HOME"), ".auth-refresher", "config.yaml")
-		file, err := os.OpenFile(configPath, os.O_RDWR|os.O_CREATE, 0644)
-		if err != nil {
-			ui.PrintError("Failed to open config file", err, true)
-			return
-		}
-		defer func() {
-			if err := file.Close(); err != nil {
-				ui.PrintError("Failed to close file", err, true)
-			}
-		}()
+		configPath := resolveConfigPath()
 
-		var config auth.Config
-		decoder := yaml.NewDecoder(file)
-		if err := decoder.Decode(&config); err != nil && err.Error() != "EOF" {
-			ui.PrintError("Failed to parse config file", err, true)
+		name, err := ui.PromptInputWithContext(ctx, "Registry Name", "", requiredInput, false)
+		if err != nil {
 			return
 		}
 
-		if config.Registries == nil {
-			config.Registries = make(map[string]auth.Registry)
-		}
-
-		name, err := ui.PromptInputWithContext(ctx, "Registry Name", "", nil, false)
+		registry := auth.Registry{Name: name}
+		provider, err := promptRegistry(ctx, &registry)
 		if err != nil {
 			return
 		}
 
-		// Updated registry type input to use a selection instead of free typing
-		typeOptions := []string{"aws", "helm", "docker"}
-		typeInput, err := ui.SelectFromList(ctx, "Registry Type", typeOptions)
-		if err != nil {
+		if err := provider.Validate(registry); err != nil {
+			ui.PrintError("Invalid registry", err, true)
 			return
 		}
 
-		url, err := ui.PromptInputWithContext(ctx, "Registry URL", "", nil, false)
+		groups, err := ui.PromptInputWithContext(ctx, "Groups (comma-separated, optional)", "", nil, false)
 		if err != nil {
 			return
 		}
 
-		region, err := ui.PromptInputWithContext(ctx, "Registry Region", "", nil, false)
+		err = auth.UpdateConfig(ctx, configPath, func(config *auth.Config) error {
+			if _, exists := config.Registries[name]; exists {
+				return fmt.Errorf("registry '%s' already exists, use `auth-refresher edit %s` to change it", name, name)
+			}
+			config.Registries[name] = registry
+			for _, group := range auth.SplitList(groups) {
+				config.AddToGroup(group, name)
+			}
+			return nil
+		})
 		if err != nil {
+			ui.PrintError("Failed to save config file", err, true)
 			return
 		}
 
-		// Updated to prompt for username and store it in the registry configuration
-		username, err := ui.PromptInputWithContext(ctx, "Registry Username", "", nil, false)
-		if err != nil {
-			return
+		ui.PrintSuccess("Registry added successfully!", name)
+	},
+}
+
+// promptRegistry asks for the type of the registry and the fields that type needs,
+// offering the current values as defaults. Secrets are asked at login time.
+func promptRegistry(ctx context.Context, registry *auth.Registry) (auth.Provider, error) {
+	// Registry types are discovered from the registered providers, the current one first
+	types := currentFirst(auth.ProviderTypes(), registry.Type)
+	typeInput, err := ui.SelectFromList(ctx, "Registry Type", types)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := auth.GetProvider(typeInput)
+	if err != nil {
+		return nil, err
+	}
+	registry.Type = typeInput
+
+	// Only prompt for the fields the registry type needs. They can depend on the
+	// previous answers (e.g. the authentication mode), so they are listed again
+	// after each one.
+	for i := 0; ; i++ {
+		fields := auth.RegistryFields(provider, *registry)
+		if i >= len(fields) {
+			break
+		}
+		field := fields[i]
+		if field.Secret {
+			continue
 		}
 
-		// Removed password prompt for Docker registries
-		if typeInput == "docker" {
-			config.Registries[name] = auth.Registry{
-				Name:     name,
-				Type:     typeInput,
-				URL:      url,
-				Region:   region,
-				Username: username, // Store only the username for Docker registries
-			}
+		var value string
+		if len(field.Options) > 0 {
+			value, err = ui.SelectFromList(ctx, field.Label, currentFirst(field.Options, registry.Field(field.Name)))
 		} else {
-			config.Registries[name] = auth.Registry{
-				Name:     name,
-				Type:     typeInput,
-				URL:      url,
-				Region:   region,
-				Username: username,
+			var validate promptui.ValidateFunc
+			if field.Required {
+				validate = requiredInput
 			}
+			value, err = ui.PromptInputWithContext(ctx, field.Label, registry.Field(field.Name), validate, false)
 		}
-
-		if err := file.Truncate(0); err != nil {
-			ui.PrintError("Failed to truncate file", err, true)
-			return
-		}
-		if _, err := file.Seek(0, 0); err != nil {
-			ui.PrintError("Failed to seek file", err, true)
-			return
+		if err != nil {
+			return nil, err
 		}
-		encoder := yaml.NewEncoder(file)
-		if err := encoder.Encode(&config); err != nil {
-			ui.PrintError("Failed to save config file", err, true)
-			return
+		registry.SetField(field.Name, value)
+	}
+
+	tags, err := ui.PromptInputWithContext(ctx, "Tags (comma-separated, optional)", strings.Join(registry.Tags, ","), nil, false)
+	if err != nil {
+		return nil, err
+	}
+	registry.Tags = auth.SplitList(tags)
+	return provider, nil
+}
+
+// currentFirst moves the current value to the top of the options, so it is preselected
+func currentFirst(options []string, current string) []string {
+	if current == "" || !slices.Contains(options, current) {
+		return options
+	}
+	sorted := []string{current}
+	for _, option := range options {
+		if option != current {
+			sorted = append(sorted, option)
 		}
+	}
+	return sorted
+}
 
-		ui.PrintSuccess("Registry added successfully!", name)
-	},
+// requiredInput rejects empty prompt answers
+func requiredInput(input string) error {
+	if strings.TrimSpace(input) == "" {
+		return errors.New("value is required")
+	}
+	return nil
 }
 
 func init() {
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/credhelper"
+)
+
+// credentialHelperBinary is the name Docker looks up for the `auth-refresher` credential helper
+var credentialHelperBinary = "docker-credential-" + auth.CredentialHelperName
+
+var credentialHelperCmd = &cobra.Command{
+	Use:       "credential-helper <get|store|erase|list>",
+	Short:     "Act as a Docker credential helper",
+	ValidArgs: []string{"get", "store", "erase", "list"},
+	Long: `Implement the Docker credential helper protocol backed by the registries of the
+configuration file. Docker, buildx, containerd and skopeo call the helper when
+they need a credential, so ECR tokens are minted on demand instead of being
+refreshed with auth-refresher login beforehand.
+
+To use it, expose auth-refresher as ` + credentialHelperBinary + ` on your PATH
+and reference it from ~/.docker/config.json:
+
+  ln -s "$(command -v auth-refresher)" ~/bin/` + credentialHelperBinary + `
+
+  {
+    "credHelpers": {
+      "123456789012.dkr.ecr.us-west-2.amazonaws.com": "` + auth.CredentialHelperName + `"
+    }
+  }`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath := resolveConfigPath()
+
+		// Docker reads errors from stdout, so keep them plain
+		if err := credhelper.Serve(cmd.Context(), configPath, args[0], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stdout, err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(credentialHelperCmd)
+}
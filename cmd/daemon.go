@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+var daemonOptions auth.DaemonOptions
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep registry logins fresh in the background",
+	Long: `Run in the foreground and log into every registry again shortly before its
+login expires. Failed logins are retried with a jittered exponential backoff and
+the configuration file is read again on every check, so edits are picked up
+without a restart. The margin is capped to a quarter of the login lifetime, so
+short-lived logins are not refreshed over and over.
+
+Registries needing a prompt (e.g. docker registries without a password or
+password_from), registries whose login never expires, and registries explicitly
+logged out of are left alone.
+
+The daemon is meant to be supervised by a systemd or launchd user unit and stops
+cleanly on SIGINT or SIGTERM.
+
+Examples:
+  # Refresh every registry 30 minutes before it expires
+  auth-refresher daemon --margin 30m
+
+  # Only keep the aws registries fresh
+  auth-refresher daemon --type aws`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Setup signal handling for graceful exit, letting in-flight logins stop first
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-c
+			ui.PrintInfo("Shutting down daemon", "")
+			cancel()
+		}()
+
+		configPath := resolveConfigPath()
+
+		ui.PrintInfo("Refresh daemon started", configPath)
+		if err := auth.RunDaemon(ctx, configPath, daemonOptions); err != nil {
+			ui.PrintError("Refresh daemon failed", err, true)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.Flags().DurationVar(&daemonOptions.Margin, "margin", auth.DefaultRefreshMargin, "Log in again this long before a login expires")
+	daemonCmd.Flags().DurationVar(&daemonOptions.PollInterval, "interval", auth.DefaultPollInterval, "Longest time between two checks of the configuration")
+	daemonCmd.Flags().DurationVar(&daemonOptions.RetryBackoff, "retry-backoff", auth.DefaultRetryBackoff, "Delay before retrying a failed login, doubled on every failure")
+	daemonCmd.Flags().DurationVar(&daemonOptions.MaxBackoff, "max-backoff", auth.DefaultMaxBackoff, "Longest delay between two retries of a failed login")
+	daemonCmd.Flags().IntVar(&daemonOptions.Concurrency, "concurrency", auth.DefaultConcurrency, "Maximum number of parallel logins")
+	daemonCmd.Flags().StringVar(&daemonOptions.Filter.Type, "type", "", "Only refresh registries of this type")
+}
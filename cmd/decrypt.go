@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Decrypt the passwords stored in the configuration file",
+	Long: `Decrypt the sensitive fields of a configuration file encrypted with encrypt and
+store them in plain text again.
+
+Examples:
+  # Go back to a plain text configuration file
+  auth-refresher decrypt`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Setup signal handling for graceful exit
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-c
+			ui.PrintInfo("Operation cancelled by user", "")
+			cancel()
+			os.Exit(0)
+		}()
+
+		configPath, _ := loadConfig(false)
+		count, err := auth.DecryptConfig(ctx, configPath)
+		if err != nil {
+			ui.PrintError("Failed to decrypt the config file", err, true)
+			return
+		}
+		ui.PrintSuccess("Config file decrypted", configPath, fmt.Sprintf("(%d values decrypted)", count))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(decryptCmd)
+}
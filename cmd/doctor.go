@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+var (
+	doctorStrict    bool
+	doctorSkipTools bool
+)
+
+var doctorCmd = &cobra.Command{
+	Use:     "doctor",
+	Aliases: []string{"validate"},
+	Short:   "Check the configuration and environment for problems",
+	Long: `Check the configuration file for registries without a type or URL, ECR URLs
+whose region disagrees with the registry region, duplicate URLs, names that
+differ from their key and files readable by other users. Also check that the
+programs each registry type needs are on PATH with a usable version.
+
+The command exits with a non-zero status when a problem is found, which makes
+it usable in CI. Warnings only fail the command with --strict.
+
+Examples:
+  # Check everything
+  auth-refresher doctor
+
+  # Only check the configuration, failing on warnings too
+  auth-refresher validate --skip-tools --strict`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, config := loadConfig(false)
+
+		ui.PrintInfo("Configuration", configPath)
+		results := auth.CheckConfig(configPath, config)
+		printCheckResults(results)
+
+		if !doctorSkipTools {
+			fmt.Println()
+			ui.PrintInfo("Tools", "")
+			tools := auth.CheckTools(cmd.Context(), config)
+			if len(tools) == 0 {
+				ui.PrintSuccess("No external tools needed")
+			}
+			printCheckResults(tools)
+			results = append(results, tools...)
+		}
+
+		errorCount, warningCount := 0, 0
+		for _, result := range results {
+			switch result.Severity {
+			case auth.CheckError:
+				errorCount++
+			case auth.CheckWarning:
+				warningCount++
+			}
+		}
+
+		fmt.Println()
+		if errorCount > 0 || (doctorStrict && warningCount > 0) {
+			ui.PrintError(fmt.Sprintf("Found %d errors and %d warnings", errorCount, warningCount), nil, true)
+			return
+		}
+		if warningCount > 0 {
+			ui.PrintWarning(fmt.Sprintf("Found %d warnings", warningCount))
+			return
+		}
+		ui.PrintSuccess("Everything looks good")
+	},
+}
+
+// printCheckResults prints the findings as a checklist, with fix hints below problems
+func printCheckResults(results []auth.CheckResult) {
+	colors := ui.NewColors()
+	for _, result := range results {
+		switch result.Severity {
+		case auth.CheckOK:
+			fmt.Printf("%s %s: %s\n", colors.Green("✓"), colors.Bold(result.Subject), result.Message)
+		case auth.CheckWarning:
+			fmt.Printf("%s %s: %s\n", colors.Yellow("!"), colors.Bold(result.Subject), result.Message)
+		case auth.CheckError:
+			fmt.Printf("%s %s: %s\n", colors.Red("✗"), colors.Bold(result.Subject), result.Message)
+		}
+		if result.Hint != "" {
+			fmt.Printf("    %s\n", colors.Faint("→ "+result.Hint))
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().BoolVar(&doctorStrict, "strict", false, "Also fail on warnings")
+	doctorCmd.Flags().BoolVar(&doctorSkipTools, "skip-tools", false, "Do not check the external programs")
+}
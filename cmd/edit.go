@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+var (
+	editSet    []string
+	editRename string
+)
+
+var editCmd = &cobra.Command{
+	Use:   "edit [name]",
+	Short: "Edit an existing registry",
+	Long: `Edit a registry of the configuration file in place. Without --set or --rename,
+the same prompts as add are shown, pre-filled with the current values.
+
+Renaming a registry keeps its display name (when it matched the old key), its
+groups and the last used registry consistent.
+
+Examples:
+  # Edit a registry interactively
+  auth-refresher edit my-ecr
+
+  # Change the region without any prompt
+  auth-refresher edit my-ecr --set region=eu-west-1 --set url=123456789012.dkr.ecr.eu-west-1.amazonaws.com
+
+  # Rename a registry
+  auth-refresher edit my-ecr --rename prod-ecr`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Setup signal handling for graceful exit
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-c
+			ui.PrintInfo("Operation cancelled by user", "")
+			cancel()
+			os.Exit(0)
+		}()
+
+		configPath, config := loadConfig(false)
+		var err error
+
+		interactive := len(editSet) == 0 && editRename == ""
+		var key string
+		if len(args) > 0 {
+			key, _, err = config.ResolveRegistry(args[0], auth.RegistryFilter{})
+			if err != nil {
+				ui.PrintError("Failed to resolve registry", err, true)
+				return
+			}
+		} else {
+			if !ui.IsInteractive() {
+				ui.PrintError("No registry name given and no terminal available to select one", nil, true)
+				return
+			}
+			key, err = ui.SelectFromList(ctx, "Select a registry to edit", config.FilterRegistries(auth.RegistryFilter{}))
+			if err != nil {
+				return
+			}
+		}
+		registry := config.Registries[key]
+
+		newKey := key
+		if interactive {
+			if !ui.IsInteractive() {
+				ui.PrintError("No terminal available to prompt, use --set or --rename", nil, true)
+				return
+			}
+			newKey, err = ui.PromptInputWithContext(ctx, "Registry Name", key, requiredInput, false)
+			if err != nil {
+				return
+			}
+			if _, err := promptRegistry(ctx, &registry); err != nil {
+				return
+			}
+		} else {
+			for _, assignment := range editSet {
+				attribute, value, found := strings.Cut(assignment, "=")
+				if !found {
+					ui.PrintError("Invalid --set value, expected key=value", fmt.Errorf("%s", assignment), true)
+					return
+				}
+				if err := registry.SetValue(strings.TrimSpace(attribute), value); err != nil {
+					ui.PrintError("Failed to update registry", err, true)
+					return
+				}
+			}
+			if editRename != "" {
+				newKey = editRename
+			}
+		}
+
+		provider, err := auth.GetProvider(registry.Type)
+		if err != nil {
+			ui.PrintError("Invalid registry", err, true)
+			return
+		}
+		if err := provider.Validate(registry); err != nil {
+			ui.PrintError("Invalid registry", err, true)
+			return
+		}
+
+		err = auth.UpdateConfig(ctx, configPath, func(config *auth.Config) error {
+			current, exists := config.Registries[key]
+			if !exists {
+				return fmt.Errorf("registry '%s' was removed while editing it", key)
+			}
+			// Keep the login state recorded by other processes in the meantime
+			registry.LastLogin, registry.LastLogout, registry.ExpiresAt = current.LastLogin, current.LastLogout, current.ExpiresAt
+			config.Registries[key] = registry
+			return config.RenameRegistry(key, newKey)
+		})
+		if err != nil {
+			ui.PrintError("Failed to update registry", err, true)
+			return
+		}
+
+		ui.PrintSuccess("Registry updated successfully!", newKey)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(editCmd)
+	editCmd.Flags().StringArrayVar(&editSet, "set", nil, "Set a registry attribute without prompting, as key=value (repeatable)")
+	editCmd.Flags().StringVar(&editRename, "rename", "", "Rename the registry to this key")
+}
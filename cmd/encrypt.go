@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the passwords stored in the configuration file",
+	Long: `Encrypt the sensitive fields (passwords) of the configuration file with a key
+derived from a passphrase. Every other field stays readable, so list, status and
+edit keep working without the passphrase, and passwords set later with edit or
+add are encrypted as well.
+
+The passphrase is asked when a password is needed, or read from
+` + auth.PassphraseEnvVar + ` when set, which is how the daemon and the credential
+helper unlock the file. Use decrypt to go back to plain text. The backups kept
+when the file was migrated from an older format hold the passwords in plain
+text, so they are deleted.
+
+Examples:
+  # Encrypt the passwords of the configuration file
+  auth-refresher encrypt`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Setup signal handling for graceful exit
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-c
+			ui.PrintInfo("Operation cancelled by user", "")
+			cancel()
+			os.Exit(0)
+		}()
+
+		configPath, _ := loadConfig(false)
+		count, removed, err := auth.EncryptConfig(ctx, configPath)
+		for _, backup := range removed {
+			ui.PrintWarning("Removed the plain text backup", backup)
+		}
+		if err != nil {
+			ui.PrintError("Failed to encrypt the config file", err, true)
+			return
+		}
+		ui.PrintSuccess("Config file encrypted", configPath, fmt.Sprintf("(%d values encrypted)", count))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(encryptCmd)
+}
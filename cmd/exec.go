@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+)
+
+var (
+	execRegistries []string
+	execNoDetect   bool
+	execMargin     time.Duration
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] -- command [args...]",
+	Short: "Run a command after making sure its registry logins are fresh",
+	Long: `Make sure the logins of the given registries are valid, logging in again when
+they are missing, expired or about to expire, then run the command with its
+stdin, stdout, stderr and exit code passed through.
+
+Registries are taken from --registry and detected from the image and chart
+references found in the command arguments (e.g. 123456789012.dkr.ecr.us-west-2.amazonaws.com/app:1.0
+or oci://registry.example.com/charts). Messages and prompts from auth-refresher go
+to stderr so the command output can be piped.
+
+Examples:
+  # Push an image, logging into the matching registry if needed
+  auth-refresher exec -- docker push 123456789012.dkr.ecr.us-west-2.amazonaws.com/app:1.0
+
+  # Name the registry explicitly
+  auth-refresher exec --registry prod-ecr -- docker compose pull`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		configPath := resolveConfigPath()
+		config, err := auth.LoadConfig(configPath)
+		if err != nil {
+			execFail("Failed to load config file", err)
+		}
+
+		var keys []string
+		for _, name := range execRegistries {
+			key, _, err := config.ResolveRegistry(name, auth.RegistryFilter{})
+			if err != nil {
+				execFail("Failed to resolve registry", err)
+			}
+			keys = append(keys, key)
+		}
+		if !execNoDetect {
+			keys = append(keys, config.RegistriesForArgs(args)...)
+		}
+
+		results, err := auth.EnsureLoggedIn(ctx, configPath, dedupe(keys), execMargin)
+		if err != nil {
+			execFail("Failed to refresh registry logins", err)
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				execFail(fmt.Sprintf("Failed to login to %s", result.Key), result.Err)
+			}
+			fmt.Fprintf(os.Stderr, "✓ Refreshed login of %s\n", result.Key)
+		}
+
+		os.Exit(runChild(args))
+	},
+}
+
+// runChild runs the command with the standard streams attached, forwarding
+// termination signals, and returns its exit code
+func runChild(args []string) int {
+	child := exec.Command(args[0], args[1:]...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	if err := child.Start(); err != nil {
+		execFail("Failed to run command", err)
+	}
+
+	// Interrupts from the terminal already reach the child, so they are only
+	// swallowed to let the child decide when to exit; the rest is forwarded
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			if sig != os.Interrupt {
+				_ = child.Process.Signal(sig)
+			}
+		}
+	}()
+
+	err := child.Wait()
+	signal.Stop(signals)
+	close(signals)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		execFail("Failed to run command", err)
+	}
+	return 0
+}
+
+// execFail reports an error on stderr, leaving stdout to the command, and exits
+func execFail(msg string, err error) {
+	fmt.Fprintf(os.Stderr, "✗ %s: %v\n", msg, err)
+	os.Exit(1)
+}
+
+// dedupe removes repeated keys, keeping the first occurrence
+func dedupe(keys []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	execCmd.Flags().StringSliceVarP(&execRegistries, "registry", "r", nil, "Registry to ensure a fresh login for (repeatable)")
+	execCmd.Flags().BoolVar(&execNoDetect, "no-detect", false, "Do not detect registries from the command arguments")
+	execCmd.Flags().DurationVar(&execMargin, "margin", 5*time.Minute, "Log in again when the login expires within this duration")
+	execCmd.Flags().SetInterspersed(false)
+}
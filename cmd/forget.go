@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+var forgetCmd = &cobra.Command{
+	Use:   "forget <name...>",
+	Short: "Forget the passwords remembered in the keyring",
+	Long: `Remove the password remembered by login --remember for each registry, from the
+keyring or the encrypted secret store, and clear its password_from so the next
+login asks for the password again. Secret store entries shared with other
+registries are kept.
+
+Examples:
+  # Forget the password of a registry
+  auth-refresher forget harbor`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Setup signal handling for graceful exit
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-c
+			ui.PrintInfo("Operation cancelled by user", "")
+			cancel()
+			os.Exit(0)
+		}()
+
+		configPath, config := loadConfig(false)
+
+		var keys []string
+		for _, name := range args {
+			key, _, err := config.ResolveRegistry(name, auth.RegistryFilter{})
+			if err != nil {
+				ui.PrintError("Failed to resolve registry", err, true)
+				return
+			}
+			keys = append(keys, key)
+		}
+
+		failed := false
+		for _, key := range keys {
+			if err := auth.ForgetPassword(ctx, configPath, key); err != nil {
+				ui.PrintError("Failed to forget the password of "+key, err, false)
+				failed = true
+				continue
+			}
+			ui.PrintSuccess("Forgot the password of", key)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(forgetCmd)
+}
@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
@@ -12,57 +17,406 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// Update references to Config
-var config auth.Config
+// Output formats supported by `list --output`
+var listOutputFormats = []string{"table", "wide", "json", "yaml", "csv", "name"}
+
+// Sort orders supported by `list --sort`
+var listSortOrders = []string{"name", "key", "type", "url", "region", "last-login", "last-logout", "expires", "status"}
+
+var (
+	listOutput   string
+	listTemplate string
+	listType     string
+	listRegion   string
+	listTag      string
+	listGroup    string
+	listExpired  bool
+	listSort     string
+	listColumns  []string
+	listRelative bool
+)
+
+// registryView is the stable, machine-readable representation of a registry used
+// by the list output formats. Secrets are never part of it.
+type registryView struct {
+	Key        string   `json:"key" yaml:"key"`
+	Name       string   `json:"name" yaml:"name"`
+	Type       string   `json:"type" yaml:"type"`
+	URL        string   `json:"url" yaml:"url"`
+	Region     string   `json:"region" yaml:"region"`
+	Username   string   `json:"username" yaml:"username"`
+	Groups     []string `json:"groups" yaml:"groups"`
+	Tags       []string `json:"tags" yaml:"tags"`
+	Optional   bool     `json:"optional" yaml:"optional"`
+	Supported  bool     `json:"supported" yaml:"supported"`
+	LastLogin  string   `json:"last_login" yaml:"last_login"`
+	LastLogout string   `json:"last_logout" yaml:"last_logout"`
+	ExpiresAt  string   `json:"expires_at" yaml:"expires_at"`
+	Status     string   `json:"status" yaml:"status"`
+
+	lastLogin, lastLogout, expiresAt time.Time // Parsed dates, for sorting and relative rendering
+}
+
+// cellFormat tells the columns how to render their value
+type cellFormat struct {
+	now      time.Time
+	relative bool // Render dates relative to now
+	table    bool // Decorate values for humans
+}
+
+// listColumn is a column of the table and csv outputs
+type listColumn struct {
+	header string // Table header
+	field  string // CSV header, the json field name
+	value  func(view registryView, format cellFormat) string
+}
+
+// listColumnsByID holds the columns accepted by `list --columns`
+var listColumnsByID = map[string]listColumn{
+	"key":      {"Key", "key", func(v registryView, _ cellFormat) string { return v.Key }},
+	"name":     {"Name", "name", func(v registryView, _ cellFormat) string { return v.Name }},
+	"type":     {"Type", "type", typeCell},
+	"url":      {"URL", "url", func(v registryView, _ cellFormat) string { return v.URL }},
+	"region":   {"Region", "region", func(v registryView, _ cellFormat) string { return v.Region }},
+	"username": {"Username", "username", func(v registryView, _ cellFormat) string { return v.Username }},
+	"groups":   {"Groups", "groups", func(v registryView, _ cellFormat) string { return strings.Join(v.Groups, ",") }},
+	"tags":     {"Tags", "tags", func(v registryView, _ cellFormat) string { return strings.Join(v.Tags, ",") }},
+	"optional": {"Optional", "optional", func(v registryView, _ cellFormat) string { return fmt.Sprint(v.Optional) }},
+	"supported": {"Supported", "supported", func(v registryView, _ cellFormat) string {
+		return fmt.Sprint(v.Supported)
+	}},
+	"last-login": {"Last Login", "last_login", func(v registryView, f cellFormat) string {
+		return timeCell(v.LastLogin, v.lastLogin, f)
+	}},
+	"last-logout": {"Last Logout", "last_logout", func(v registryView, f cellFormat) string {
+		return timeCell(v.LastLogout, v.lastLogout, f)
+	}},
+	"expires": {"Expires At", "expires_at", func(v registryView, f cellFormat) string {
+		return timeCell(v.ExpiresAt, v.expiresAt, f)
+	}},
+	"status": {"Status", "status", func(v registryView, _ cellFormat) string { return v.Status }},
+}
+
+// Column sets of the default outputs
+var (
+	tableColumns = []string{"name", "type", "url", "region", "last-login", "last-logout"}
+	wideColumns  = []string{"key", "name", "type", "url", "region", "username", "groups", "tags", "last-login", "last-logout", "expires", "status"}
+	csvColumns   = []string{"key", "name", "type", "url", "region", "username", "groups", "tags", "optional", "supported", "last-login", "last-logout", "expires", "status"}
+)
 
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all registries in a table format",
+	Long: `List the registries of the configuration file.
+
+Besides the default table, --output selects a wide table with computed fields,
+json, yaml, csv, or name (one registry key per line). Machine-readable formats
+use stable field names: key, name, type, url, region, username, groups, tags,
+optional, supported, last_login, last_logout, expires_at and status.
+
+--template renders every registry with a Go text/template, using the field
+names of the Go structure (.Key, .Name, .Type, .URL, .Region, .Username,
+.Groups, .Tags, .Optional, .Supported, .LastLogin, .LastLogout, .ExpiresAt,
+.Status).
+
+Registries can be narrowed down with --type, --region, --tag, --group and
+--expired, and sorted with --sort (dates sort oldest first, registries without
+the date last). --columns picks the columns of the table and csv outputs among
+key, name, type, url, region, username, groups, tags, optional, supported,
+last-login, last-logout, expires and status. --relative shows the dates of
+these outputs relative to now, such as "3h ago".
+
+Examples:
+  # Registries as JSON
+  auth-refresher list -o json
+
+  # Only the keys, e.g. for shell completion
+  auth-refresher list -o name
+
+  # Expired ECR registries of a region
+  auth-refresher list --type aws --region eu-west-1 --expired
+
+  # A compact table, most recent login last
+  auth-refresher list --columns name,url,expires --sort last-login --relative
+
+  # Custom format
+  auth-refresher list --template '{{.Key}} expires {{.ExpiresAt}} ({{.Status}})'`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
+		_, config := loadConfig(false)
 
-		configPath := filepath.Join(os.Getenv("HOME"), ".auth-refresher", "config.yaml")
-		file, err := os.Open(configPath)
+		now := time.Now()
+		filter := auth.RegistryFilter{Type: listType, Region: listRegion, Tag: listTag}
+		keys, err := config.SelectRegistries(listGroup, filter)
 		if err != nil {
-			ui.PrintError("Failed to open config file", err, true)
-			return
+			ui.PrintError("Failed to resolve group", err, true)
+		}
+		views := []registryView{}
+		for _, key := range keys {
+			view := newRegistryView(config, key, now)
+			if listExpired && view.Status != string(auth.StatusExpired) {
+				continue
+			}
+			views = append(views, view)
+		}
+
+		if err := sortRegistryViews(views, listSort); err != nil {
+			ui.PrintError("Failed to sort registries", err, true)
+		}
+		if err := renderRegistries(views, now); err != nil {
+			ui.PrintError("Failed to render registries", err, true)
+		}
+	},
+}
+
+// newRegistryView builds the output representation of a registry, with its computed fields
+func newRegistryView(config *auth.Config, key string, now time.Time) registryView {
+	registry := config.Registries[key]
+	_, err := auth.GetProvider(registry.Type)
+	view := registryView{
+		Key:        key,
+		Name:       registry.Name,
+		Type:       registry.Type,
+		URL:        registry.ServerURL(),
+		Region:     registry.Region,
+		Username:   registry.Username,
+		Groups:     []string{},
+		Tags:       append([]string{}, registry.Tags...),
+		Optional:   registry.Optional,
+		Supported:  err == nil,
+		LastLogin:  registry.LastLogin,
+		LastLogout: registry.LastLogout,
+		Status:     string(registry.Status(now, auth.DefaultExpiringSoon)),
+	}
+	view.lastLogin, _ = time.ParseInLocation(auth.TimeFormat, registry.LastLogin, time.Local)
+	view.lastLogout, _ = time.ParseInLocation(auth.TimeFormat, registry.LastLogout, time.Local)
+	if expiresAt, ok := registry.ExpiryTime(); ok && registry.LastLogin != "" {
+		view.ExpiresAt = expiresAt.Format(auth.TimeFormat)
+		view.expiresAt = expiresAt
+	}
+	for group, members := range config.Groups {
+		for _, member := range members {
+			if member == key {
+				view.Groups = append(view.Groups, group)
+			}
 		}
-		defer func() {
-			if err := file.Close(); err != nil {
-				ui.PrintError("Failed to close file", err, true)
+	}
+	sort.Strings(view.Groups)
+	return view
+}
+
+// sortRegistryViews orders the registries by the given field, then by name and type
+func sortRegistryViews(views []registryView, order string) error {
+	var less func(a, b registryView) int
+	byTime := func(get func(registryView) time.Time) func(a, b registryView) int {
+		return func(a, b registryView) int {
+			ta, tb := get(a), get(b)
+			switch {
+			case ta.IsZero() && tb.IsZero():
+				return 0
+			case ta.IsZero():
+				return 1 // Missing dates go last
+			case tb.IsZero():
+				return -1
 			}
-		}()
+			return ta.Compare(tb)
+		}
+	}
+
+	switch order {
+	case "name", "":
+		less = func(a, b registryView) int { return 0 }
+	case "key":
+		less = func(a, b registryView) int { return strings.Compare(a.Key, b.Key) }
+	case "type":
+		less = func(a, b registryView) int { return strings.Compare(a.Type, b.Type) }
+	case "url":
+		less = func(a, b registryView) int { return strings.Compare(a.URL, b.URL) }
+	case "region":
+		less = func(a, b registryView) int { return strings.Compare(a.Region, b.Region) }
+	case "status":
+		less = func(a, b registryView) int { return strings.Compare(a.Status, b.Status) }
+	case "last-login":
+		less = byTime(func(v registryView) time.Time { return v.lastLogin })
+	case "last-logout":
+		less = byTime(func(v registryView) time.Time { return v.lastLogout })
+	case "expires":
+		less = byTime(func(v registryView) time.Time { return v.expiresAt })
+	default:
+		return fmt.Errorf("unknown sort order '%s', expected one of %s", order, strings.Join(listSortOrders, ", "))
+	}
 
-		decoder := yaml.NewDecoder(file)
-		if err := decoder.Decode(&config); err != nil {
-			ui.PrintError("Failed to parse config file", err, true)
-			return
+	sort.SliceStable(views, func(i, j int) bool {
+		if c := less(views[i], views[j]); c != 0 {
+			return c < 0
 		}
+		if views[i].Name != views[j].Name {
+			return views[i].Name < views[j].Name
+		}
+		return views[i].Type < views[j].Type
+	})
+	return nil
+}
 
-		// Sort registries by name and then by type
-		sortedKeys := make([]string, 0, len(config.Registries))
-		for key := range config.Registries {
-			sortedKeys = append(sortedKeys, key)
+// renderRegistries writes the registries to stdout in the selected format
+func renderRegistries(views []registryView, now time.Time) error {
+	if listTemplate != "" {
+		tmpl, err := template.New("list").Parse(listTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid template: %w", err)
 		}
-		sort.Slice(sortedKeys, func(i, j int) bool {
-			if config.Registries[sortedKeys[i]].Name == config.Registries[sortedKeys[j]].Name {
-				return config.Registries[sortedKeys[i]].Type < config.Registries[sortedKeys[j]].Type
+		for _, view := range views {
+			var out strings.Builder
+			if err := tmpl.Execute(&out, view); err != nil {
+				return fmt.Errorf("failed to render template: %w", err)
 			}
-			return config.Registries[sortedKeys[i]].Name < config.Registries[sortedKeys[j]].Name
-		})
+			fmt.Println(strings.TrimSuffix(out.String(), "\n"))
+		}
+		return nil
+	}
 
-		// Use sortedKeys to iterate and display registries
+	columnIDs := listColumns
+	switch listOutput {
+	case "table", "":
+		if len(columnIDs) == 0 {
+			columnIDs = tableColumns
+		}
+	case "wide":
+		if len(columnIDs) == 0 {
+			columnIDs = wideColumns
+		}
+	case "csv":
+		if len(columnIDs) == 0 {
+			columnIDs = csvColumns
+		}
+	case "json", "yaml", "name":
+		if len(columnIDs) > 0 {
+			return fmt.Errorf("--columns only applies to the table, wide and csv outputs")
+		}
+	default:
+		return fmt.Errorf("unknown output format '%s', expected one of %s", listOutput, strings.Join(listOutputFormats, ", "))
+	}
+	columns := make([]listColumn, 0, len(columnIDs))
+	for _, id := range columnIDs {
+		column, exists := listColumnsByID[id]
+		if !exists {
+			return fmt.Errorf("unknown column '%s'", id)
+		}
+		columns = append(columns, column)
+	}
+
+	switch listOutput {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(views)
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(views); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "name":
+		for _, view := range views {
+			fmt.Println(view.Key)
+		}
+	case "csv":
+		format := cellFormat{now: now, relative: listRelative}
+		writer := csv.NewWriter(os.Stdout)
+		header := make([]string, len(columns))
+		for i, column := range columns {
+			header[i] = column.field
+		}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		for _, view := range views {
+			row := make([]string, len(columns))
+			for i, column := range columns {
+				row[i] = column.value(view, format)
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		format := cellFormat{now: now, relative: listRelative, table: true}
 		t := table.NewWriter()
 		t.SetOutputMirror(os.Stdout)
-		t.AppendHeader(table.Row{"Name", "Type", "URL", "Region", "Last Login", "Last Logout"})
-		for _, key := range sortedKeys {
-			registry := config.Registries[key]
-			t.AppendRow(table.Row{registry.Name, registry.Type, registry.URL, registry.Region, registry.LastLogin, registry.LastLogout})
+		header := make(table.Row, len(columns))
+		for i, column := range columns {
+			header[i] = column.header
+		}
+		t.AppendHeader(header)
+		for _, view := range views {
+			row := make(table.Row, len(columns))
+			for i, column := range columns {
+				row[i] = column.value(view, format)
+			}
+			t.AppendRow(row)
 		}
-
 		t.Render()
-	},
+	}
+	return nil
+}
+
+// typeCell renders the registry type, flagging types no provider handles in tables
+func typeCell(view registryView, format cellFormat) string {
+	if format.table && !view.Supported {
+		return view.Type + " (unsupported)"
+	}
+	return view.Type
+}
+
+// timeCell renders a date, relative to now when requested
+func timeCell(value string, t time.Time, format cellFormat) string {
+	if !format.relative || t.IsZero() {
+		return value
+	}
+	return relativeTime(t, format.now)
+}
+
+// relativeTime renders how far a date is from now, such as "3h ago" or "in 2d"
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	var amount string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		amount = fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < 48*time.Hour:
+		amount = fmt.Sprintf("%dh", int(d/time.Hour))
+	default:
+		amount = fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	}
+	if future {
+		return "in " + amount
+	}
+	return amount + " ago"
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", "table", "Output format: "+strings.Join(listOutputFormats, ", "))
+	listCmd.Flags().StringVar(&listTemplate, "template", "", "Render every registry with this Go text/template")
+	listCmd.Flags().StringVar(&listType, "type", "", "Only list registries of this type")
+	listCmd.Flags().StringVar(&listRegion, "region", "", "Only list registries of this region")
+	listCmd.Flags().StringVar(&listTag, "tag", "", "Only list registries with this tag")
+	listCmd.Flags().StringVar(&listGroup, "group", "", "Only list registries of the named group")
+	listCmd.Flags().BoolVar(&listExpired, "expired", false, "Only list registries whose login is expired")
+	listCmd.Flags().StringVar(&listSort, "sort", "name", "Sort by: "+strings.Join(listSortOrders, ", "))
+	listCmd.Flags().StringSliceVar(&listColumns, "columns", nil, "Comma-separated columns of the table and csv outputs")
+	listCmd.Flags().BoolVar(&listRelative, "relative", false, "Show dates relative to now (e.g. 3h ago)")
+	listCmd.MarkFlagsMutuallyExclusive("output", "template")
+	_ = listCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(listOutputFormats, cobra.ShellCompDirectiveNoFileComp))
+	_ = listCmd.RegisterFlagCompletionFunc("sort", cobra.FixedCompletions(listSortOrders, cobra.ShellCompDirectiveNoFileComp))
 }
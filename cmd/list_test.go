@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/auth"
+)
+
+// listNow is the time the list tests run at
+var listNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+
+// setListFlag sets a flag of `list` for the duration of the test
+func setListFlag[T any](t *testing.T, flag *T, value T) {
+	t.Helper()
+	previous := *flag
+	*flag = value
+	t.Cleanup(func() { *flag = previous })
+}
+
+// captureStdout returns what fn writes to stdout
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	err = fn()
+	os.Stdout = stdout
+	w.Close()
+	return <-out, err
+}
+
+// listViews returns the views of a logged in ECR registry and of a registry
+// of an unsupported type never logged into
+func listViews() []registryView {
+	config := &auth.Config{
+		Registries: map[string]auth.Registry{
+			"ecr": {Name: "prod", Type: "aws", URL: "123456789012.dkr.ecr.us-west-2.amazonaws.com", Region: "us-west-2",
+				Tags: []string{"team-a"}, LastLogin: listNow.Add(-3 * time.Hour).Format(auth.TimeFormat)},
+			"old": {Name: "legacy", Type: "quay", URL: "quay.io", Username: "me", Optional: true},
+		},
+		Groups: map[string][]string{"staging": {"old"}, "prod": {"ecr", "old"}},
+	}
+	return []registryView{newRegistryView(config, "ecr", listNow), newRegistryView(config, "old", listNow)}
+}
+
+func TestNewRegistryView(t *testing.T) {
+	views := listViews()
+	ecr, old := views[0], views[1]
+	wantExpiry := listNow.Add(9 * time.Hour).Format(auth.TimeFormat) // 12h ECR tokens
+	if !ecr.Supported || ecr.ExpiresAt != wantExpiry || ecr.Status != string(auth.StatusValid) {
+		t.Errorf("got supported %v, expiry %q and status %q, want a supported valid login expiring at %s",
+			ecr.Supported, ecr.ExpiresAt, ecr.Status, wantExpiry)
+	}
+	if !slices.Equal(ecr.Groups, []string{"prod"}) || !slices.Equal(ecr.Tags, []string{"team-a"}) {
+		t.Errorf("got groups %v and tags %v", ecr.Groups, ecr.Tags)
+	}
+	if old.Supported || old.ExpiresAt != "" || old.Status != string(auth.StatusNeverLogged) {
+		t.Errorf("got supported %v, expiry %q and status %q, want an unsupported registry never logged into",
+			old.Supported, old.ExpiresAt, old.Status)
+	}
+	if !slices.Equal(old.Groups, []string{"prod", "staging"}) || old.Tags == nil {
+		t.Errorf("got groups %v and tags %v, want sorted groups and empty lists rather than null", old.Groups, old.Tags)
+	}
+}
+
+func TestRenderRegistries(t *testing.T) {
+	views := listViews()
+	lastLogin := views[0].LastLogin
+	expiresAt := views[0].ExpiresAt
+	tests := []struct {
+		name     string
+		output   string
+		template string
+		columns  []string
+		relative bool
+		want     string
+		wantErr  string
+	}{
+		{name: "name", output: "name", want: "ecr\nold\n"},
+		{name: "template", template: "{{.Key}} {{.Status}}\n", want: "ecr valid\nold not logged in\n"},
+		{name: "csv columns", output: "csv", columns: []string{"key", "type", "last-login", "expires"},
+			want: "key,type,last_login,expires_at\necr,aws," + lastLogin + "," + expiresAt + "\nold,quay,,\n"},
+		{name: "csv relative", output: "csv", columns: []string{"key", "last-login", "expires"}, relative: true,
+			want: "key,last_login,expires_at\necr,3h ago,in 9h\nold,,\n"},
+		{name: "invalid template", template: "{{.Key", wantErr: "invalid template"},
+		{name: "unknown field", template: "{{.Password}}", wantErr: "failed to render template"},
+		{name: "unknown output", output: "xml", wantErr: "unknown output format 'xml'"},
+		{name: "unknown column", output: "csv", columns: []string{"password"}, wantErr: "unknown column 'password'"},
+		{name: "columns of json", output: "json", columns: []string{"key"}, wantErr: "--columns only applies"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setListFlag(t, &listOutput, tt.output)
+			setListFlag(t, &listTemplate, tt.template)
+			setListFlag(t, &listColumns, tt.columns)
+			setListFlag(t, &listRelative, tt.relative)
+			got, err := captureStdout(t, func() error { return renderRegistries(views, listNow) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// The json output keeps stable field names and never includes secrets
+func TestRenderRegistriesJSON(t *testing.T) {
+	setListFlag(t, &listOutput, "json")
+	got, err := captureStdout(t, func() error { return renderRegistries(listViews(), listNow) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, got)
+	}
+	want := []string{"expires_at", "groups", "key", "last_login", "last_logout", "name", "optional", "region",
+		"status", "supported", "tags", "type", "url", "username"}
+	for _, view := range decoded {
+		fields := make([]string, 0, len(view))
+		for field := range view {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+		if !slices.Equal(fields, want) {
+			t.Errorf("got fields %v, want %v", fields, want)
+		}
+	}
+}
+
+func TestTypeCell(t *testing.T) {
+	views := listViews()
+	tests := []struct {
+		name   string
+		view   registryView
+		format cellFormat
+		want   string
+	}{
+		{"supported in a table", views[0], cellFormat{table: true}, "aws"},
+		{"unsupported in a table", views[1], cellFormat{table: true}, "quay (unsupported)"},
+		{"unsupported in csv", views[1], cellFormat{}, "quay"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := typeCell(tt.view, tt.format); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortRegistryViews(t *testing.T) {
+	at := func(ago time.Duration) time.Time { return listNow.Add(-ago) }
+	views := []registryView{
+		{Key: "c", Name: "beta", Type: "gcp", URL: "b.example.com", Region: "eu-west-1", Status: "valid", lastLogin: at(time.Hour)},
+		{Key: "a", Name: "beta", Type: "aws", URL: "c.example.com", Region: "us-west-2", Status: "expired", lastLogin: at(3 * time.Hour),
+			lastLogout: at(time.Hour), expiresAt: at(-time.Hour)},
+		{Key: "d", Name: "delta", Type: "docker", URL: "a.example.com", Status: "not logged in"},
+		{Key: "b", Name: "alpha", Type: "helm", URL: "d.example.com", Region: "eu-west-1", Status: "valid", lastLogin: at(2 * time.Hour),
+			expiresAt: at(-2 * time.Hour)},
+	}
+	tests := []struct {
+		order string
+		want  []string // Keys in order
+	}{
+		{"", []string{"b", "a", "c", "d"}},
+		{"name", []string{"b", "a", "c", "d"}}, // Same names break by type
+		{"key", []string{"a", "b", "c", "d"}},
+		{"type", []string{"a", "d", "c", "b"}},
+		{"url", []string{"d", "c", "a", "b"}},
+		{"region", []string{"d", "b", "c", "a"}}, // No region sorts first, like any empty string
+		{"status", []string{"a", "d", "b", "c"}},
+		// Dates sort oldest first, registries without the date last
+		{"last-login", []string{"a", "b", "c", "d"}},
+		{"last-logout", []string{"a", "b", "c", "d"}},
+		{"expires", []string{"a", "b", "c", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			sorted := slices.Clone(views)
+			if err := sortRegistryViews(sorted, tt.order); err != nil {
+				t.Fatal(err)
+			}
+			keys := make([]string, len(sorted))
+			for i, view := range sorted {
+				keys[i] = view.Key
+			}
+			if !slices.Equal(keys, tt.want) {
+				t.Errorf("got %v, want %v", keys, tt.want)
+			}
+		})
+	}
+
+	if err := sortRegistryViews(views, "size"); err == nil || !strings.Contains(err.Error(), "unknown sort order 'size'") {
+		t.Errorf("got %v, want an unknown sort order error", err)
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	tests := []struct {
+		offset time.Duration // Of the date from now
+		want   string
+	}{
+		{0, "just now"},
+		{-59 * time.Second, "just now"},
+		{59 * time.Second, "just now"},
+		{-time.Minute, "1m ago"},
+		{-59*time.Minute - 59*time.Second, "59m ago"},
+		{-time.Hour, "1h ago"},
+		{-3*time.Hour - 30*time.Minute, "3h ago"},
+		{-47 * time.Hour, "47h ago"},
+		{-48 * time.Hour, "2d ago"},
+		{-10 * 24 * time.Hour, "10d ago"},
+		{5 * time.Minute, "in 5m"},
+		{9 * time.Hour, "in 9h"},
+		{72 * time.Hour, "in 3d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.offset.String(), func(t *testing.T) {
+			if got := relativeTime(listNow.Add(tt.offset), listNow); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeCell(t *testing.T) {
+	login := listNow.Add(-3 * time.Hour)
+	value := login.Format(auth.TimeFormat)
+	tests := []struct {
+		name   string
+		value  string
+		t      time.Time
+		format cellFormat
+		want   string
+	}{
+		{"absolute", value, login, cellFormat{now: listNow}, value},
+		{"relative", value, login, cellFormat{now: listNow, relative: true}, "3h ago"},
+		{"relative without date", "", time.Time{}, cellFormat{now: listNow, relative: true}, ""},
+		{"relative unparsable date", "yesterday", time.Time{}, cellFormat{now: listNow, relative: true}, "yesterday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := timeCell(tt.value, tt.t, tt.format); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
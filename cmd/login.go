@@ -2,19 +2,71 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 	"github.com/user-cube/auth-refresher/pkg/auth"
 	"github.com/user-cube/auth-refresher/pkg/ui"
 )
 
+var (
+	loginType        string
+	loginURL         string
+	loginAll         bool
+	loginGroup       string
+	loginTag         string
+	loginConcurrency int
+	loginRemember    bool
+)
+
 var loginCmd = &cobra.Command{
-	Use:   "login",
+	Use:   "login [name]",
 	Short: "Login to a selected registry",
+	Long: `Login to a registry from the configuration file.
+
+When a registry name is given the login runs without any prompt, which makes it
+usable from scripts and CI. Without a name an interactive picker is shown,
+restricted to the registries matching the --type and --url filters.
+
+Several registries can be logged into at once, in parallel, with --all, --group,
+--tag or by passing more than one name. --group and --tag can be combined to
+select the registries of a group carrying a tag. A result table is printed at the end and the
+command exits with a non-zero status if any login failed.
+
+With --remember, a password typed at the prompt (or configured in plain text) is
+stored in the desktop keyring through the Secret Service once the login
+succeeds, and password_from points at it so later logins do not ask again. When
+no keyring is running, the encrypted secret store is used instead. Use forget
+to remove a remembered password.
+
+Examples:
+  # Pick a registry interactively
+  auth-refresher login
+
+  # Login to a registry by name
+  auth-refresher login my-ecr
+
+  # Login to the only docker registry with the given URL
+  auth-refresher login --type docker --url registry.example.com
+
+  # Login to every aws registry, 8 at a time
+  auth-refresher login --all --type aws --concurrency 8
+
+  # Login to every registry of a group
+  auth-refresher login --group staging
+
+  # Login to everything for project X in staging
+  auth-refresher login --group staging --tag project-x
+
+  # Type the password once and keep it in the keyring
+  auth-refresher login harbor --remember`,
+	Args: cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Setup signal handling for graceful exit
 		c := make(chan os.Signal, 1)
@@ -27,20 +79,20 @@ var loginCmd = &cobra.Command{
 			os.Exit(0)
 		}()
 
-		configPath := filepath.Join(os.Getenv("HOME"), ".auth-refresher", "config.yaml")
-		file, err := os.OpenFile(configPath, os.O_RDWR|os.O_CREATE, 0644)
-		if err != nil {
-			ui.PrintError("Failed to open config file", err, true)
-			return err
+		configPath := resolveConfigPath()
+
+		filter := auth.RegistryFilter{Type: loginType, URL: loginURL, Tag: loginTag}
+		if loginAll || loginGroup != "" || loginTag != "" || len(args) > 1 {
+			return runBatchLogin(ctx, configPath, args, filter)
+		}
+
+		var name string
+		if len(args) > 0 {
+			name = args[0]
 		}
-		defer func() {
-			if err := file.Close(); err != nil {
-				ui.PrintError("Failed to close file", err, true)
-			}
-		}()
 
 		// Call LoginToRegistry without spinner
-		err = auth.LoginToRegistry(ctx, configPath)
+		err := auth.LoginToRegistry(ctx, configPath, name, filter, loginRemember)
 		if err != nil {
 			ui.PrintError("Failed to login to registry", err, true)
 			return err
@@ -49,6 +101,84 @@ var loginCmd = &cobra.Command{
 	},
 }
 
+// runBatchLogin resolves the selected registries and logs into all of them concurrently
+func runBatchLogin(ctx context.Context, configPath string, names []string, filter auth.RegistryFilter) error {
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		ui.PrintError("Failed to load config file", err, true)
+		return err
+	}
+
+	var keys []string
+	if len(names) == 0 {
+		keys, err = config.SelectRegistries(loginGroup, filter)
+		if err != nil {
+			ui.PrintError("Failed to resolve group", err, true)
+			return err
+		}
+	} else {
+		for _, name := range names {
+			key, _, err := config.ResolveRegistry(name, filter)
+			if err != nil {
+				ui.PrintError("Failed to resolve registry", err, true)
+				return err
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		err := fmt.Errorf("no registry matches the given selection")
+		ui.PrintError("Nothing to login to", err, true)
+		return err
+	}
+
+	results, err := auth.LoginToRegistries(ctx, configPath, keys, loginConcurrency, loginRemember)
+	if err != nil {
+		ui.PrintError("Failed to login to registries", err, true)
+		return err
+	}
+
+	failed := printLoginResults(results)
+	if failed > 0 {
+		err := fmt.Errorf("%d of %d logins failed", failed, len(results))
+		ui.PrintError("Batch login finished with errors", err, true)
+		return err
+	}
+	ui.PrintSuccess("Successfully logged into all registries:", fmt.Sprintf("%d", len(results)))
+	return nil
+}
+
+// printLoginResults renders the per registry outcome of a batch login and returns the number of failures
+func printLoginResults(results []auth.LoginResult) int {
+	colors := ui.NewColors()
+	failed := 0
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Name", "Type", "Status", "Duration", "Error"})
+	for _, result := range results {
+		status := colors.Green("✓ success")
+		reason := ""
+		if result.Err != nil {
+			status = colors.Red("✗ failed")
+			reason = result.Err.Error()
+			failed++
+		}
+		t.AppendRow(table.Row{result.Key, result.Registry.Type, status, result.Duration.Round(time.Millisecond), reason})
+	}
+	t.Render()
+
+	return failed
+}
+
 func init() {
 	rootCmd.AddCommand(loginCmd)
+	loginCmd.Flags().StringVar(&loginType, "type", "", "Only consider registries of this type ("+strings.Join(auth.ProviderTypes(), ", ")+")")
+	loginCmd.Flags().StringVar(&loginURL, "url", "", "Only consider registries with this URL")
+	loginCmd.Flags().BoolVar(&loginAll, "all", false, "Login to every registry matching the filters")
+	loginCmd.Flags().StringVar(&loginGroup, "group", "", "Login to every registry of the named group")
+	loginCmd.Flags().StringVar(&loginTag, "tag", "", "Login to every registry with this tag")
+	loginCmd.Flags().IntVar(&loginConcurrency, "concurrency", auth.DefaultConcurrency, "Maximum number of parallel logins")
+	loginCmd.Flags().BoolVar(&loginRemember, "remember", false, "Remember the password in the keyring once logged in")
+	loginCmd.MarkFlagsMutuallyExclusive("all", "group")
 }
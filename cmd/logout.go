@@ -1,109 +1,140 @@
 package cmd
 
 import (
-	"os"
-	"os/exec"
-	"path/filepath"
+	"fmt"
 	"sort"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/user-cube/auth-refresher/pkg/auth"
 	"github.com/user-cube/auth-refresher/pkg/ui"
-	"gopkg.in/yaml.v3"
+)
+
+var (
+	logoutType  string
+	logoutGroup string
+	logoutTag   string
 )
 
 var logoutCmd = &cobra.Command{
-	Use:   "logout",
+	Use:   "logout [name...]",
 	Short: "Logout from a selected registry",
-	Run: func(cmd *cobra.Command, args []string) {
-		configPath := filepath.Join(os.Getenv("HOME"), ".auth-refresher", "config.yaml")
-		file, err := os.Open(configPath)
-		if err != nil {
-			ui.PrintError("Failed to open config file", err, true)
-			return
-		}
+	Long: `Logout from registries of the configuration file, removing their stored
+credentials.
 
-		var config auth.Config
-		decoder := yaml.NewDecoder(file)
-		if err := decoder.Decode(&config); err != nil {
-			ui.PrintError("Failed to parse config file", err, true)
-			return
-		}
+Registries are given by name, or selected with --group, --tag and --type, which
+can be combined. Without any of them an interactive picker is shown.
 
-		// Sort registries by name and then by type
-		keys := make([]string, 0, len(config.Registries))
-		for key := range config.Registries {
-			keys = append(keys, key)
-		}
-		sort.Slice(keys, func(i, j int) bool {
-			if config.Registries[keys[i]].Name == config.Registries[keys[j]].Name {
-				return config.Registries[keys[i]].Type < config.Registries[keys[j]].Type
-			}
-			return config.Registries[keys[i]].Name < config.Registries[keys[j]].Name
-		})
+Examples:
+  # Pick a registry interactively
+  auth-refresher logout
 
-		selected, err := ui.SelectFromList(cmd.Context(), "Select a registry to logout", keys)
-		if err != nil {
-			if err.Error() == "operation cancelled by user" {
-				return // Gracefully handle user cancellation
-			}
-			ui.PrintError("Failed to select a registry", err, true)
-			return
-		}
+  # Logout from a registry by name
+  auth-refresher logout my-ecr
 
-		// Clear credentials for the selected registry
-		registry := config.Registries[selected]
+  # Logout from everything for project X in staging
+  auth-refresher logout --group staging --tag project-x`,
+	Args: cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, config := loadConfig(false)
 
-		// Perform Docker logout for both AWS and Docker registries
-		if registry.Type == "docker" || registry.Type == "aws" {
-			logoutCmd := exec.Command("docker", "logout", registry.URL)
-			if err := logoutCmd.Run(); err != nil {
-				ui.PrintError("Failed to perform Docker logout", err, true)
+		filter := auth.RegistryFilter{Type: logoutType, Tag: logoutTag}
+		var keys []string
+		switch {
+		case len(args) > 0:
+			for _, name := range args {
+				key, _, err := config.ResolveRegistry(name, filter)
+				if err != nil {
+					ui.PrintError("Failed to resolve registry", err, true)
+					return
+				}
+				keys = append(keys, key)
+			}
+			keys = dedupe(keys)
+		case logoutGroup != "" || filter != auth.RegistryFilter{}:
+			var err error
+			keys, err = config.SelectRegistries(logoutGroup, filter)
+			if err != nil {
+				ui.PrintError("Failed to resolve group", err, true)
 				return
 			}
-		}
-
-		// Perform Helm logout for Helm registries
-		if registry.Type == "helm" {
-			logoutCmd := exec.Command("helm", "registry", "logout", registry.URL)
-			if err := logoutCmd.Run(); err != nil {
-				ui.PrintError("Failed to perform Helm logout", err, true)
+			if len(keys) == 0 {
+				ui.PrintError("Nothing to logout from", fmt.Errorf("no registry matches the given selection"), true)
+				return
+			}
+		default:
+			if !ui.IsInteractive() {
+				ui.PrintError("No registry name given and no terminal available to select one", nil, true)
+				return
+			}
+			selected, err := ui.SelectFromList(cmd.Context(), "Select a registry to logout", sortedRegistryKeys(config))
+			if err != nil {
+				if err.Error() == "operation cancelled by user" {
+					return // Gracefully handle user cancellation
+				}
+				ui.PrintError("Failed to select a registry", err, true)
 				return
 			}
+			keys = []string{selected}
 		}
 
-		// Only update the `LastLogout` field with the current date
-		registry.LastLogout = time.Now().Format("2006-01-02 15:04:05") // Set the last logout date
-		config.Registries[selected] = registry                         // Update the registry entry in the configuration
-
-		// Save the updated configuration
-		file, err = os.Create(configPath)
-		if err != nil {
-			ui.PrintError("Failed to open config file for writing", err, true)
-			return
-		}
-		defer func() {
-			if err := file.Close(); err != nil {
-				ui.PrintError("Failed to close file", err, true)
+		// The registry type's provider knows how to clear its credentials
+		var loggedOut []string
+		failed := 0
+		for _, key := range keys {
+			if err := auth.Logout(cmd.Context(), config.Registries[key]); err != nil {
+				ui.PrintError(fmt.Sprintf("Failed to logout from registry %s", key), err, false)
+				failed++
+				continue
 			}
-		}()
+			loggedOut = append(loggedOut, key)
+		}
 
-		encoder := yaml.NewEncoder(file)
-		defer func() {
-			if err := encoder.Close(); err != nil {
-				ui.PrintError("Failed to close encoder", err, true)
+		// Only update the `LastLogout` field with the current date, on top of the latest configuration
+		err := auth.UpdateConfig(cmd.Context(), configPath, func(config *auth.Config) error {
+			now := time.Now()
+			for _, key := range loggedOut {
+				registry, exists := config.Registries[key]
+				if !exists {
+					continue
+				}
+				registry.RecordLogout(now)        // Set the last logout date and forget the expiry
+				config.Registries[key] = registry // Update the registry entry in the configuration
 			}
-		}()
-		if err := encoder.Encode(&config); err != nil {
+			return nil
+		})
+		if err != nil {
 			ui.PrintError("Failed to write updated config", err, true)
 			return
 		}
 
-		ui.PrintSuccess("Successfully logged out from registry:", selected)
+		for _, key := range loggedOut {
+			ui.PrintSuccess("Successfully logged out from registry:", key)
+		}
+		if failed > 0 {
+			ui.PrintError("Logout finished with errors", fmt.Errorf("%d of %d logouts failed", failed, len(keys)), true)
+		}
 	},
 }
 
+// sortedRegistryKeys returns the registry keys sorted by registry name and then by type
+func sortedRegistryKeys(config *auth.Config) []string {
+	keys := make([]string, 0, len(config.Registries))
+	for key := range config.Registries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if config.Registries[keys[i]].Name == config.Registries[keys[j]].Name {
+			return config.Registries[keys[i]].Type < config.Registries[keys[j]].Type
+		}
+		return config.Registries[keys[i]].Name < config.Registries[keys[j]].Name
+	})
+	return keys
+}
+
 func init() {
 	rootCmd.AddCommand(logoutCmd)
-}
\ No newline at end of file
+	logoutCmd.Flags().StringVar(&logoutType, "type", "", "Only consider registries of this type")
+	logoutCmd.Flags().StringVar(&logoutGroup, "group", "", "Logout from every registry of the named group")
+	logoutCmd.Flags().StringVar(&logoutTag, "tag", "", "Logout from every registry with this tag")
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+var (
+	removeLogout bool
+	removeYes    bool
+)
+
+var removeCmd = &cobra.Command{
+	Use:     "remove [name...]",
+	Aliases: []string{"rm"},
+	Short:   "Remove registries from the configuration",
+	Long: `Remove one or more registries from the configuration file. Without a name, the
+registries to remove are picked from a list.
+
+Examples:
+  # Pick the registries to remove
+  auth-refresher remove
+
+  # Remove a registry and its stored credential, without confirmation
+  auth-refresher remove my-ecr --logout --yes`,
+	Args: cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Setup signal handling for graceful exit
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-c
+			ui.PrintInfo("Operation cancelled by user", "")
+			cancel()
+			os.Exit(0)
+		}()
+
+		configPath, config := loadConfig(false)
+		var err error
+
+		var keys []string
+		if len(args) > 0 {
+			for _, name := range args {
+				key, _, err := config.ResolveRegistry(name, auth.RegistryFilter{})
+				if err != nil {
+					ui.PrintError("Failed to resolve registry", err, true)
+					return
+				}
+				keys = append(keys, key)
+			}
+		} else {
+			if !ui.IsInteractive() {
+				ui.PrintError("No registry name given and no terminal available to select one", nil, true)
+				return
+			}
+			keys, err = ui.MultiSelectFromList(ctx, "Select the registries to remove", config.FilterRegistries(auth.RegistryFilter{}))
+			if err != nil {
+				if err.Error() == "operation cancelled by user" {
+					return // Gracefully handle user cancellation
+				}
+				ui.PrintError("Failed to select registries", err, true)
+				return
+			}
+		}
+		keys = dedupe(keys)
+		if len(keys) == 0 {
+			ui.PrintInfo("Nothing to remove", "")
+			return
+		}
+		sort.Strings(keys)
+
+		if !removeYes {
+			if !ui.IsInteractive() {
+				ui.PrintError("Refusing to remove registries without confirmation, use --yes", nil, true)
+				return
+			}
+			confirmed, err := ui.ConfirmWithContext(ctx, fmt.Sprintf("Remove %s", strings.Join(keys, ", ")))
+			if err != nil || !confirmed {
+				ui.PrintInfo("Nothing removed", "")
+				return
+			}
+		}
+
+		if removeLogout {
+			for _, key := range keys {
+				if err := auth.Logout(ctx, config.Registries[key]); err != nil {
+					ui.PrintWarning(fmt.Sprintf("Failed to logout from %s: %v", key, err))
+				}
+			}
+		}
+
+		err = auth.UpdateConfig(ctx, configPath, func(config *auth.Config) error {
+			for _, key := range keys {
+				config.RemoveRegistry(key)
+			}
+			return nil
+		})
+		if err != nil {
+			ui.PrintError("Failed to save config file", err, true)
+			return
+		}
+
+		ui.PrintSuccess("Registries removed successfully:", keys...)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(removeCmd)
+	removeCmd.Flags().BoolVar(&removeLogout, "logout", false, "Also remove the stored credentials of the registries")
+	removeCmd.Flags().BoolVarP(&removeYes, "yes", "y", false, "Do not ask for confirmation")
+}
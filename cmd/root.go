@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/ui"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -15,7 +19,35 @@ Docker and ECR registry logins. It provides an intuitive interface for selecting
 from a configuration file and handles login operations with support for AWS and Helm registries.`,
 }
 
+// configFlag holds the value of the global --config flag
+var configFlag string
+
+// resolveConfigPath returns the configuration file used by every command
+func resolveConfigPath() string {
+	return auth.ConfigPath(configFlag)
+}
+
+// loadConfig resolves the configuration file and loads it, exiting with an error
+// message on failure. A missing file yields an empty configuration when
+// allowMissing is set, so it can be created.
+func loadConfig(allowMissing bool) (string, *auth.Config) {
+	path := resolveConfigPath()
+	config, err := auth.LoadConfig(path)
+	if err != nil {
+		if allowMissing && errors.Is(err, os.ErrNotExist) {
+			return path, &auth.Config{Registries: make(map[string]auth.Registry)}
+		}
+		ui.PrintError("Failed to load config file", err, true)
+	}
+	return path, config
+}
+
 func Execute() {
+	// When invoked as docker-credential-auth-refresher, behave as the credential helper
+	if filepath.Base(os.Args[0]) == credentialHelperBinary {
+		rootCmd.SetArgs(append([]string{credentialHelperCmd.Name()}, os.Args[1:]...))
+	}
+
 	err := rootCmd.Execute()
 	if err != nil {
 		os.Exit(1)
@@ -23,5 +55,6 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&configFlag, "config", "", "Configuration file (default: $"+auth.ConfigEnvVar+", a trusted ./"+auth.ProjectConfigName+", $XDG_CONFIG_HOME/auth-refresher/config.yaml or ~/.auth-refresher/config.yaml)")
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
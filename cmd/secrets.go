@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/secret"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage the encrypted secret store",
+	Long: `Manage the local secret store, a file encrypted with a passphrase holding the
+passwords referenced as password_from: store:<name> by the registries.
+
+The store lives in ~/.local/share/auth-refresher/secrets.enc (or under
+$XDG_DATA_HOME), or wherever ` + auth.SecretStoreEnvVar + ` points. The passphrase is
+asked when needed, or read from ` + auth.PassphraseEnvVar + ` when set, which is
+how the daemon and other runs without a terminal unlock the store.
+
+Examples:
+  # Store a password, typed at a masked prompt
+  auth-refresher secrets set harbor
+
+  # Store a password read from another tool
+  pass show registry/harbor | auth-refresher secrets set harbor
+
+  # Reference it from a registry
+  auth-refresher edit harbor --set password_from=store:harbor`,
+}
+
+var secretsSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "Add or replace a secret, read from stdin or a masked prompt",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := secretsContext()
+
+		var value *secret.Secret
+		if ui.IsInteractive() {
+			input, err := ui.PromptInput(ctx, fmt.Sprintf("Secret value (%s)", args[0]), true) // Enable masking for secret input
+			if err != nil {
+				if err.Error() == "operation cancelled by user" {
+					return
+				}
+				ui.PrintError("Failed to read the secret", err, true)
+				return
+			}
+			value = secret.FromString(input)
+		} else {
+			input, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				ui.PrintError("Failed to read the secret", err, true)
+				return
+			}
+			value = secret.New(bytes.TrimRight(input, "\r\n"))
+		}
+		defer value.Zero()
+		if value.Empty() {
+			ui.PrintError("Failed to read the secret", fmt.Errorf("secret '%s' is empty", args[0]), true)
+			return
+		}
+
+		err := auth.UpdateSecretStore(ctx, func(entries map[string]string) error {
+			entries[args[0]] = value.Reveal()
+			return nil
+		})
+		if err != nil {
+			ui.PrintError("Failed to store the secret", err, true)
+			return
+		}
+		ui.PrintSuccess("Stored secret", args[0], "(password_from: store:"+args[0]+")")
+	},
+}
+
+var secretsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the names of the stored secrets",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		names, err := auth.StoredSecretNames(secretsContext())
+		if err != nil {
+			ui.PrintError("Failed to read the secret store", err, true)
+			return
+		}
+		if len(names) == 0 {
+			ui.PrintInfo("The secret store is empty", auth.SecretStorePath())
+			return
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	},
+}
+
+var secretsRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a secret from the store",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := auth.UpdateSecretStore(secretsContext(), func(entries map[string]string) error {
+			if _, exists := entries[args[0]]; !exists {
+				return fmt.Errorf("secret '%s' not found in the secret store", args[0])
+			}
+			delete(entries, args[0])
+			return nil
+		})
+		if err != nil {
+			ui.PrintError("Failed to remove the secret", err, true)
+			return
+		}
+		ui.PrintSuccess("Removed secret", args[0])
+	},
+}
+
+// secretsContext sets up signal handling for graceful exit and returns the
+// context cancelled by it
+func secretsContext() context.Context {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-c
+		ui.PrintInfo("Operation cancelled by user", "")
+		cancel()
+		os.Exit(0)
+	}()
+	return ctx
+}
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsSetCmd, secretsListCmd, secretsRemoveCmd)
+}
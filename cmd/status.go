@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+var (
+	statusType         string
+	statusGroup        string
+	statusTag          string
+	statusExpiringSoon time.Duration
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status [name...]",
+	Short: "Show whether the login of each registry is still valid",
+	Long: `Show the login status of every registry: valid, expiring soon, expired, not
+logged in, or no expiry for registries whose credentials never expire.
+
+Expiry comes from the token itself when possible (ECR tokens last 12 hours, JWT
+passwords carry an exp claim) or from the ttl field of the registry otherwise.
+The command exits with a non-zero status when a registry not marked as
+optional is expired, which makes it usable as a CI or shell prompt check.
+
+Examples:
+  # Show the status of every registry
+  auth-refresher status
+
+  # Check a single registry, warning 2 hours before it expires
+  auth-refresher status my-ecr --expiring-soon 2h
+
+  # Check everything for project X in staging
+  auth-refresher status --group staging --tag project-x`,
+	Args: cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		_, config := loadConfig(false)
+
+		filter := auth.RegistryFilter{Type: statusType, Tag: statusTag}
+		keys, err := config.SelectRegistries(statusGroup, filter)
+		if err != nil {
+			ui.PrintError("Failed to resolve group", err, true)
+			return
+		}
+		if len(args) > 0 {
+			keys = keys[:0]
+			for _, name := range args {
+				key, _, err := config.ResolveRegistry(name, filter)
+				if err != nil {
+					ui.PrintError("Failed to resolve registry", err, true)
+					return
+				}
+				keys = append(keys, key)
+			}
+		}
+
+		colors := ui.NewColors()
+		now := time.Now()
+		expired := 0
+
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Name", "Type", "Last Login", "Expires At", "Remaining", "Status"})
+		for _, key := range keys {
+			registry := config.Registries[key]
+			status := registry.Status(now, statusExpiringSoon)
+
+			expiresAt, remaining := "", ""
+			if expiry, ok := registry.ExpiryTime(); ok && registry.LastLogin != "" {
+				expiresAt = expiry.Format(auth.TimeFormat)
+				if expiry.After(now) {
+					remaining = expiry.Sub(now).Round(time.Minute).String()
+				}
+			}
+
+			label := string(status)
+			switch status {
+			case auth.StatusValid, auth.StatusNoExpiry:
+				label = colors.Green(label)
+			case auth.StatusExpiringSoon:
+				label = colors.Yellow(label)
+			case auth.StatusExpired:
+				label = colors.Red(label)
+				if !registry.Optional {
+					expired++
+				}
+			}
+			if registry.Optional {
+				label += colors.Faint(" (optional)")
+			}
+			t.AppendRow(table.Row{key, registry.Type, registry.LastLogin, expiresAt, remaining, label})
+		}
+		t.Render()
+
+		if expired > 0 {
+			ui.PrintError("Some registry logins are expired", fmt.Errorf("%d expired", expired), true)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringVar(&statusType, "type", "", "Only show registries of this type")
+	statusCmd.Flags().StringVar(&statusGroup, "group", "", "Only show registries of the named group")
+	statusCmd.Flags().StringVar(&statusTag, "tag", "", "Only show registries with this tag")
+	statusCmd.Flags().DurationVar(&statusExpiringSoon, "expiring-soon", auth.DefaultExpiringSoon, "Report logins expiring within this duration as expiring soon")
+}
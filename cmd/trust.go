@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+var trustRevoke bool
+
+var trustCmd = &cobra.Command{
+	Use:   "trust [path]",
+	Short: "Allow a project-local configuration file to be used",
+	Long: `Allow the ` + auth.ProjectConfigName + ` of the current directory (or the given
+file) to be picked up when auth-refresher runs from its directory. Untrusted
+project-local files are ignored, so a cloned repository cannot change which
+registries Docker logs into.
+
+A trusted project-local file still cannot run commands or read files: cmd: and
+file: password sources, token_command and key_file are refused unless the file
+is named with --config or $` + auth.ConfigEnvVar + `.
+
+Examples:
+  # Use the project-local file of the current directory
+  auth-refresher trust
+
+  # Stop using it
+  auth-refresher trust --revoke`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := auth.ProjectConfigPath()
+		if len(args) == 1 {
+			path = args[0]
+		}
+		if !trustRevoke {
+			if _, err := os.Stat(path); err != nil {
+				ui.PrintError("Failed to trust the config file", err, true)
+				return
+			}
+		}
+
+		if err := auth.TrustConfig(path, !trustRevoke); err != nil {
+			ui.PrintError("Failed to update the trusted config files", err, true)
+			return
+		}
+		if trustRevoke {
+			ui.PrintSuccess("No longer trusting", path)
+		} else {
+			ui.PrintSuccess("Trusting", path)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(trustCmd)
+	trustCmd.Flags().BoolVar(&trustRevoke, "revoke", false, "Stop trusting the file")
+}
@@ -1,215 +1,441 @@
 package auth
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"os"
-	"os/exec"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/user-cube/auth-refresher/pkg/secret"
 	"github.com/user-cube/auth-refresher/pkg/ui"
-	"gopkg.in/yaml.v3"
 )
 
+// Config is the registry configuration. Only the registry definitions are stored
+// in the configuration file, the runtime state (last used registry, login and
+// logout dates) lives in a separate state file, see StatePath.
 type Config struct {
-	CurrentRegistry string              `yaml:"last_used_registry"`
+	Version         int                 `yaml:"version"`
+	Encryption      *Encryption         `yaml:"encryption,omitempty"` // Set when the sensitive fields are encrypted, see EncryptConfig
+	CurrentRegistry string              `yaml:"-"`                    // Stored in the state file as last_used_registry
 	Registries      map[string]Registry `yaml:"registries"`
+	Groups          map[string][]string `yaml:"groups,omitempty"` // Named sets of registry keys
 }
 
 type Registry struct {
-	Name       string `yaml:"name"`
-	Type       string `yaml:"type"`
-	URL        string `yaml:"url"`
-	Region     string `yaml:"region"`
-	Username   string `yaml:"username"`
-	Password   string `yaml:"password"`
-	LastLogin  string `yaml:"last_login"`  // Field to store the last login date
-	LastLogout string `yaml:"last_logout"` // Field to store the last logout date
-}
-
-// LoadConfig loads the configuration from the given file path
-func LoadConfig(filePath string) (*Config, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open config file: %w", err)
+	Name         string   `yaml:"name"`
+	Type         string   `yaml:"type"`
+	URL          string   `yaml:"url"`
+	Region       string   `yaml:"region,omitempty"`
+	Username     string   `yaml:"username,omitempty"`
+	Password     string   `yaml:"password,omitempty"`
+	PasswordFrom string   `yaml:"password_from,omitempty"` // Where to read the password at login time, see ResolveSecret
+	Tags         []string `yaml:"tags,omitempty"`          // Free-form labels used to select registries (e.g. project or environment)
+	TTL          string   `yaml:"ttl,omitempty"`           // Login lifetime (e.g. "24h") for types that cannot tell on their own
+	Optional     bool     `yaml:"optional,omitempty"`      // Optional registries do not fail `status` when expired
+	LastLogin    string   `yaml:"-"`                       // Field to store the last login date, kept in the state file
+	LastLogout   string   `yaml:"-"`                       // Field to store the last logout date, kept in the state file
+	ExpiresAt    string   `yaml:"-"`                       // Field to store when the last login expires, kept in the state file
+
+	// AWS settings of ECR hosted registries
+	AccountID       string `yaml:"account_id,omitempty"`        // With the region, gives the registry URL when url is empty
+	Profile         string `yaml:"profile,omitempty"`           // Profile of the shared AWS config and credentials files
+	RoleARN         string `yaml:"role_arn,omitempty"`          // Role assumed before requesting the ECR token
+	RoleSessionName string `yaml:"role_session_name,omitempty"` // Session name of the assumed role, auth-refresher by default
+	ExternalID      string `yaml:"external_id,omitempty"`       // External ID required by the trust policy of the role
+
+	// Helm settings
+	Auth         string `yaml:"auth,omitempty"`          // How to authenticate: ecr (default), basic or token
+	Mode         string `yaml:"mode,omitempty"`          // oci (default) for `helm registry login`, repo for `helm repo add`
+	RepoName     string `yaml:"repo_name,omitempty"`     // Name of the classic Helm repository, the registry key by default
+	TokenCommand string `yaml:"token_command,omitempty"` // Command printing the password of the token authentication
+
+	// Google Cloud settings of Artifact Registry and Container Registry
+	TokenSource    string `yaml:"token_source,omitempty"`    // Where the access token comes from: gcloud (default), key or metadata
+	KeyFile        string `yaml:"key_file,omitempty"`        // Service account JSON key of the key source, GOOGLE_APPLICATION_CREDENTIALS by default
+	ServiceAccount string `yaml:"service_account,omitempty"` // Account of the gcloud and metadata sources, the active or default one when empty
+
+	encryption *Encryption    // Encryption settings of the file the registry was read from
+	discovered bool           // Read from a project-local file found rather than named, see checkDiscovered
+	password   *secret.Secret // Password read by fillSecrets for the next login, zeroed once it is done
+}
+
+// ServerURL is the URL of the registry, derived from the account ID and region
+// of ECR registries when no url is configured
+func (r Registry) ServerURL() string {
+	if r.URL == "" && r.AccountID != "" && r.Region != "" {
+		return ECRURL(r.AccountID, r.Region)
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			fmt.Println("Error closing file:", err)
-		}
-	}()
+	return r.URL
+}
+
+// RegistryFilter narrows down the registries considered for an operation.
+// Empty fields match everything.
+type RegistryFilter struct {
+	Type   string
+	URL    string
+	Region string
+	Tag    string
+}
 
-	var config Config
-	decoder := yaml.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+// Matches reports whether the registry satisfies every non-empty filter field
+func (f RegistryFilter) Matches(registry Registry) bool {
+	if f.Type != "" && registry.Type != f.Type {
+		return false
+	}
+	if f.URL != "" && normalizeURL(registry.ServerURL()) != normalizeURL(f.URL) {
+		return false
 	}
+	if f.Region != "" && registry.Region != f.Region {
+		return false
+	}
+	if f.Tag != "" && !registry.HasTag(f.Tag) {
+		return false
+	}
+	return true
+}
+
+// HasTag reports whether the registry is labelled with the tag
+func (r Registry) HasTag(tag string) bool {
+	return slices.Contains(r.Tags, tag)
+}
 
-	return &config, nil
+// normalizeURL strips the scheme and trailing slashes so URLs can be compared loosely
+func normalizeURL(url string) string {
+	url = strings.TrimPrefix(url, "https://")
+	url = strings.TrimPrefix(url, "http://")
+	url = strings.TrimPrefix(url, "oci://")
+	return strings.TrimRight(url, "/")
 }
 
-// Login handles the login process for the selected registry
-func Login(registry Registry) error {
-	switch registry.Type {
-	case "aws":
-		ui.PrintInfo("Logging into AWS ECR", registry.URL)
-		cmd := fmt.Sprintf("aws ecr get-login-password --region %s | docker login --username AWS --password-stdin %s", registry.Region, registry.URL)
-		if err := executeCommand(cmd); err != nil {
-			return fmt.Errorf("failed to login to AWS ECR: %w", err)
+// ResolveRegistry finds a registry by its configuration key (or its display name)
+// and checks it against the filter. When name is empty the filter alone must
+// match exactly one registry. It never prompts.
+func (c *Config) ResolveRegistry(name string, filter RegistryFilter) (string, Registry, error) {
+	if name != "" {
+		key := name
+		registry, exists := c.Registries[key]
+		if !exists {
+			for k, r := range c.Registries {
+				if r.Name == name {
+					key, registry, exists = k, r, true
+					break
+				}
+			}
 		}
-	case "helm":
-		ui.PrintInfo("Logging into Helm registry", registry.URL)
-		cmd := fmt.Sprintf("helm registry login %s", registry.URL)
-		if err := executeCommand(cmd); err != nil {
-			return fmt.Errorf("failed to login to Helm registry: %w", err)
+		if !exists {
+			return "", Registry{}, fmt.Errorf("registry '%s' not found in the configuration", name)
 		}
+		if !filter.Matches(registry) {
+			return "", Registry{}, fmt.Errorf("registry '%s' does not match the given filters", name)
+		}
+		return key, registry, nil
+	}
+
+	matches := c.FilterRegistries(filter)
+	switch len(matches) {
+	case 0:
+		return "", Registry{}, fmt.Errorf("no registry matches the given filters")
+	case 1:
+		return matches[0], c.Registries[matches[0]], nil
 	default:
-		return fmt.Errorf("unsupported registry type: %s", registry.Type)
+		return "", Registry{}, fmt.Errorf("%d registries match the given filters, please specify a name", len(matches))
 	}
+}
 
-	ui.PrintSuccess("Successfully logged into", registry.Name)
-	return nil
+// FilterRegistries returns the sorted keys of all registries matching the filter
+func (c *Config) FilterRegistries(filter RegistryFilter) []string {
+	var keys []string
+	for key, registry := range c.Registries {
+		if filter.Matches(registry) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
 }
 
-// executeCommand runs a shell command
-func executeCommand(cmd string) error {
-	fmt.Println("Executing:", cmd)
-	return nil // Replace with actual command execution logic
+// GroupRegistries returns the sorted keys of the registries in the named group
+func (c *Config) GroupRegistries(group string) ([]string, error) {
+	members, exists := c.Groups[group]
+	if !exists {
+		return nil, fmt.Errorf("group '%s' not found in the configuration", group)
+	}
+	keys := make([]string, 0, len(members))
+	for _, member := range members {
+		if _, exists := c.Registries[member]; !exists {
+			return nil, fmt.Errorf("group '%s' references unknown registry '%s'", group, member)
+		}
+		keys = append(keys, member)
+	}
+	sort.Strings(keys)
+	return keys, nil
 }
 
-// Updated `LoginToRegistry` function to ensure the spinner starts only after the user selects a registry
-func LoginToRegistry(ctx context.Context, configPath string) error {
-	file, err := os.Open(configPath)
+// SelectRegistries returns the sorted keys of the registries matching the filter,
+// restricted to the members of the named group when group is not empty
+func (c *Config) SelectRegistries(group string, filter RegistryFilter) ([]string, error) {
+	if group == "" {
+		return c.FilterRegistries(filter), nil
+	}
+	members, err := c.GroupRegistries(group)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	var keys []string
+	for _, key := range members {
+		if filter.Matches(c.Registries[key]) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
 
-	var config Config
-	decoder := yaml.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return err
+// AddToGroup makes the registry a member of the named group, creating the group if needed
+func (c *Config) AddToGroup(group, key string) {
+	for _, member := range c.Groups[group] {
+		if member == key {
+			return
+		}
 	}
+	if c.Groups == nil {
+		c.Groups = make(map[string][]string)
+	}
+	c.Groups[group] = append(c.Groups[group], key)
+}
 
-	// Ensure the current registry appears on top with extra info
-	currentRegistry := config.CurrentRegistry
-	var sortedOptions []string
-	for key, registry := range config.Registries {
-		if key == currentRegistry {
-			sortedOptions = append([]string{key + " (last one used)|" + registry.Type}, sortedOptions...)
-		} else {
-			sortedOptions = append(sortedOptions, key+"|"+registry.Type)
+// RemoveRegistry deletes a registry from the configuration, along with its group
+// memberships, and forgets it as the last used registry
+func (c *Config) RemoveRegistry(key string) {
+	delete(c.Registries, key)
+	if c.CurrentRegistry == key {
+		c.CurrentRegistry = ""
+	}
+	for group, members := range c.Groups {
+		kept := members[:0]
+		for _, member := range members {
+			if member != key {
+				kept = append(kept, member)
+			}
 		}
+		c.Groups[group] = kept
 	}
-	sort.Strings(sortedOptions[1:]) // Sort the rest of the options, excluding the first (current registry)
+}
 
-	var options []string
-	for _, sortedOption := range sortedOptions {
-		parts := strings.Split(sortedOption, "|")
-		options = append(options, parts[0])
+// RenameRegistry moves a registry to a new key, keeping its display name (when it
+// matched the key), its group memberships and the last used registry consistent
+func (c *Config) RenameRegistry(oldKey, newKey string) error {
+	if oldKey == newKey {
+		return nil
+	}
+	registry, exists := c.Registries[oldKey]
+	if !exists {
+		return fmt.Errorf("registry '%s' not found in the configuration", oldKey)
+	}
+	if _, exists := c.Registries[newKey]; exists {
+		return fmt.Errorf("registry '%s' already exists", newKey)
 	}
 
-	selected, err := ui.SelectFromList(ctx, "Select a registry to login", options)
-	if err != nil {
-		if err.Error() == "operation cancelled by user" {
-			return nil // Gracefully handle user cancellation
+	if registry.Name == oldKey || registry.Name == "" {
+		registry.Name = newKey
+	}
+	delete(c.Registries, oldKey)
+	c.Registries[newKey] = registry
+	if c.CurrentRegistry == oldKey {
+		c.CurrentRegistry = newKey
+	}
+	for _, members := range c.Groups {
+		for i, member := range members {
+			if member == oldKey {
+				members[i] = newKey
+			}
 		}
-		return err
 	}
+	return nil
+}
 
-	// Strip the label '(last one used)' from the selected registry name
-	cleanedSelected := strings.TrimSuffix(selected, " (last one used)")
-	registry, exists := config.Registries[cleanedSelected]
-	if !exists {
-		return fmt.Errorf("registry '%s' not found in the configuration", cleanedSelected)
+// SetValue sets a registry attribute from its configuration key, as used by `edit --set`
+func (r *Registry) SetValue(key, value string) error {
+	switch key {
+	case "name":
+		r.Name = value
+	case "type":
+		if _, err := GetProvider(value); err != nil {
+			return err
+		}
+		r.Type = value
+	case FieldURL, FieldRegion, FieldUsername, FieldPassword, FieldPasswordFrom, FieldAccountID, FieldProfile, FieldRoleARN, FieldRoleSessionName, FieldExternalID,
+		FieldAuth, FieldMode, FieldRepoName, FieldTokenCommand, FieldTokenSource, FieldKeyFile, FieldServiceAccount:
+		r.SetField(key, value)
+	case "tags":
+		r.Tags = SplitList(value)
+	case "ttl":
+		if value != "" {
+			if _, err := time.ParseDuration(value); err != nil {
+				return fmt.Errorf("invalid ttl '%s': %w", value, err)
+			}
+		}
+		r.TTL = value
+	case "optional":
+		optional, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid optional value '%s': %w", value, err)
+		}
+		r.Optional = optional
+	default:
+		return fmt.Errorf("unknown registry attribute '%s'", key)
 	}
+	return nil
+}
 
-	// Ensure the registry type is not empty
-	if registry.Type == "" {
-		return fmt.Errorf("registry '%s' has no type defined in the configuration", cleanedSelected)
+// SplitList parses a comma-separated list such as tags, dropping blanks and duplicates
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" && !slices.Contains(items, item) {
+			items = append(items, item)
+		}
 	}
+	return items
+}
 
-	// Validate the registry type before starting the spinner
-	if registry.Type != "aws" && registry.Type != "helm" && registry.Type != "docker" {
-		return fmt.Errorf("unsupported registry type: %s", registry.Type)
+// selectRegistry asks the user to pick one of the registries matching the filter,
+// keeping the last used registry on top
+func selectRegistry(ctx context.Context, config *Config, filter RegistryFilter) (string, error) {
+	keys := config.FilterRegistries(filter)
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no registry matches the given filters")
 	}
 
-	if registry.Type == "docker" {
-		password := registry.Password
-		if password == "" {
-			var err error
-			password, err = ui.PromptInput(ctx, "Enter your Docker password", true) // Enable masking for password input
-			if err != nil {
-				fmt.Println("Error reading password:", err)
-				return err
-			}
+	// Ensure the current registry appears on top with extra info
+	var options []string
+	for _, key := range keys {
+		if key == config.CurrentRegistry {
+			options = append([]string{key + " (last one used)"}, options...)
+		} else {
+			options = append(options, key)
 		}
-		registry.Password = password // Update the registry object with the password
 	}
 
-	// Start the spinner after gathering necessary inputs
-	err = ui.WithSpinner("Logging in to the selected registry", func() error {
-		switch registry.Type {
-		case "docker":
-			loginCmd := exec.CommandContext(ctx, "docker", "login", "--username", registry.Username, "--password", registry.Password, registry.URL)
-			if err := loginCmd.Run(); err != nil {
-				return err
-			}
-		case "aws":
-			cmd := exec.CommandContext(ctx, "aws", "ecr", "get-login-password", "--region", registry.Region)
-			output, err := cmd.Output()
-			if err != nil {
-				return err
-			}
-			loginCmd := exec.CommandContext(ctx, "docker", "login", "--username", "AWS", "--password-stdin", registry.URL)
-			loginCmd.Stdin = bytes.NewReader(output)
-			if err := loginCmd.Run(); err != nil {
-				return err
-			}
-		case "helm":
-			cmd := exec.CommandContext(ctx, "aws", "ecr", "get-login-password", "--region", registry.Region)
-			output, err := cmd.Output()
-			if err != nil {
-				return err
-			}
-			loginCmd := exec.CommandContext(ctx, "helm", "registry", "login", registry.URL, "--username", "AWS", "--password", string(output))
-			if err := loginCmd.Run(); err != nil {
-				return err
+	selected, err := ui.SelectFromList(ctx, "Select a registry to login", options)
+	if err != nil {
+		return "", err
+	}
+
+	// Strip the label '(last one used)' from the selected registry name
+	return strings.TrimSuffix(selected, " (last one used)"), nil
+}
+
+// LoginToRegistry logs into the registry identified by name. When name is empty
+// the user picks one interactively among the registries matching the filter.
+// The spinner only starts once all the required input has been gathered. With
+// remember, a password typed or configured in plain text is moved to the keyring
+// once the login succeeds, see RememberPassword.
+func LoginToRegistry(ctx context.Context, configPath string, name string, filter RegistryFilter, remember bool) error {
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	var selected string
+	var registry Registry
+	if name != "" || (filter != RegistryFilter{} && len(config.FilterRegistries(filter)) == 1) {
+		selected, registry, err = config.ResolveRegistry(name, filter)
+		if err != nil {
+			return err
+		}
+	} else {
+		if !ui.IsInteractive() {
+			return fmt.Errorf("no registry name given and no terminal available to select one")
+		}
+		selected, err = selectRegistry(ctx, config, filter)
+		if err != nil {
+			if err.Error() == "operation cancelled by user" {
+				return nil // Gracefully handle user cancellation
 			}
+			return err
 		}
-		return nil
-	}, false)
+		registry = config.Registries[selected]
+	}
+
+	// Validate the registry before starting the spinner
+	provider, err := GetProvider(registry.Type)
 	if err != nil {
+		return fmt.Errorf("registry '%s': %w", selected, err)
+	}
+	if err := provider.Validate(registry); err != nil {
 		return err
 	}
+	if err := fillSecrets(ctx, selected, provider, &registry); err != nil {
+		return err
+	}
+	defer registry.password.Zero()
 
-	// Update the `last_used_registry` field in the configuration
-	config.CurrentRegistry = cleanedSelected
-	registry.Password = ""                                        // Clear the password field for security reasons
-	registry.LastLogin = time.Now().Format("2006-01-02 15:04:05") // Update the `LastLogin` field with the current date
-	config.Registries[cleanedSelected] = registry                 // Update the registry entry in the configuration
-
-	file, err = os.Create(configPath)
+	// Start the spinner after gathering necessary inputs
+	var expiresAt time.Time
+	err = ui.WithSpinner("Logging in to the selected registry", func() error {
+		var err error
+		expiresAt, err = provider.Login(ctx, registry)
+		return err
+	}, false)
 	if err != nil {
-		return fmt.Errorf("failed to open config file for writing: %w", err)
+		return err
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			fmt.Println("Error closing file:", err)
+	var passwordFrom string
+	if remember && canRemember(registry) {
+		if passwordFrom, err = rememberRegistryPassword(ctx, selected, registry); err != nil {
+			ui.PrintWarning(fmt.Sprintf("Failed to remember the password of %s: %v", selected, err))
 		}
-	}()
+	}
 
-	encoder := yaml.NewEncoder(file)
-	defer func() {
-		if err := encoder.Close(); err != nil {
-			fmt.Println("Error closing encoder:", err)
+	// Only record the login on top of the latest configuration, so concurrent changes are kept
+	return UpdateConfig(ctx, configPath, func(config *Config) error {
+		stored, exists := config.Registries[selected]
+		if !exists {
+			return nil // Removed while logging in
 		}
-	}()
-	if err := encoder.Encode(&config); err != nil {
-		return fmt.Errorf("failed to write updated config: %w", err)
-	}
+		if passwordFrom != "" {
+			stored.PasswordFrom = passwordFrom // Read the password from the keyring from now on
+			stored.Password = ""
+		}
+		// A password typed at the prompt only lives in the local copy of the registry,
+		// the configured one (possibly encrypted) is kept for the next logins
+		config.CurrentRegistry = selected         // Update the `last_used_registry` field in the configuration
+		stored.recordLogin(time.Now(), expiresAt) // Update the `LastLogin` and `ExpiresAt` fields
+		config.Registries[selected] = stored      // Update the registry entry in the configuration
+		return nil
+	})
+}
 
+// fillSecrets reads the password of the registry, decrypted, from its source
+// (password_from) or asked for, and keeps it in the registry until the caller
+// zeroes it once the login is done. It runs before any spinner so prompts,
+// including the passphrase of the secret store, stay readable, and fails when
+// no terminal is available to prompt on. The password is the only secret field.
+func fillSecrets(ctx context.Context, key string, provider Provider, registry *Registry) error {
+	for _, field := range RegistryFields(provider, *registry) {
+		if !field.Secret || !field.Required || field.Name != FieldPassword {
+			continue
+		}
+		if registry.hasSecret(field.Name) {
+			password, err := registryPassword(ctx, *registry)
+			if err != nil {
+				return err
+			}
+			registry.password = password
+			continue
+		}
+		if !ui.IsInteractive() {
+			return fmt.Errorf("registry '%s' has no %s configured and no terminal is available to prompt for it", key, field.Name)
+		}
+		value, err := ui.PromptInput(ctx, fmt.Sprintf("%s (%s)", field.Label, key), true) // Enable masking for secret input
+		if err != nil {
+			return err
+		}
+		registry.password = secret.FromString(value)
+	}
 	return nil
-}
\ No newline at end of file
+}
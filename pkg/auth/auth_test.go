@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// selectorConfig holds registries of several types, regions and tags, grouped by environment
+func selectorConfig() *Config {
+	return &Config{
+		Registries: map[string]Registry{
+			"ecr-staging": {Type: "aws", URL: "123456789012.dkr.ecr.eu-west-1.amazonaws.com", Region: "eu-west-1", Tags: []string{"project-x", "staging"}},
+			"ecr-prod":    {Type: "aws", URL: "210987654321.dkr.ecr.us-west-2.amazonaws.com", Region: "us-west-2", Tags: []string{"project-x"}},
+			"gar":         {Type: "gcp", URL: "https://europe-west1-docker.pkg.dev", Tags: []string{"staging"}},
+			"hub":         {Type: "docker", URL: "https://index.docker.io/v1/"},
+		},
+		Groups: map[string][]string{
+			"staging": {"gar", "ecr-staging"},
+			"empty":   {},
+			"broken":  {"hub", "gone"},
+		},
+	}
+}
+
+func TestRegistryFilterMatches(t *testing.T) {
+	registry := selectorConfig().Registries["ecr-staging"]
+	tests := []struct {
+		name   string
+		filter RegistryFilter
+		want   bool
+	}{
+		{"empty filter", RegistryFilter{}, true},
+		{"type", RegistryFilter{Type: "aws"}, true},
+		{"other type", RegistryFilter{Type: "gcp"}, false},
+		{"url with a scheme and a trailing slash", RegistryFilter{URL: "https://123456789012.dkr.ecr.eu-west-1.amazonaws.com/"}, true},
+		{"other url", RegistryFilter{URL: "210987654321.dkr.ecr.us-west-2.amazonaws.com"}, false},
+		{"region", RegistryFilter{Region: "eu-west-1"}, true},
+		{"other region", RegistryFilter{Region: "us-west-2"}, false},
+		{"tag", RegistryFilter{Tag: "staging"}, true},
+		{"other tag", RegistryFilter{Tag: "project-y"}, false},
+		{"tag matched whole", RegistryFilter{Tag: "project"}, false},
+		{"every field", RegistryFilter{Type: "aws", Region: "eu-west-1", Tag: "project-x"}, true},
+		{"one field off", RegistryFilter{Type: "aws", Region: "eu-west-1", Tag: "project-y"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(registry); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectRegistries(t *testing.T) {
+	config := selectorConfig()
+	tests := []struct {
+		name    string
+		group   string
+		filter  RegistryFilter
+		want    []string
+		wantErr string
+	}{
+		{"everything", "", RegistryFilter{}, []string{"ecr-prod", "ecr-staging", "gar", "hub"}, ""},
+		{"tag", "", RegistryFilter{Tag: "project-x"}, []string{"ecr-prod", "ecr-staging"}, ""},
+		{"no match", "", RegistryFilter{Tag: "project-y"}, nil, ""},
+		{"group, sorted", "staging", RegistryFilter{}, []string{"ecr-staging", "gar"}, ""},
+		{"group and tag", "staging", RegistryFilter{Tag: "project-x"}, []string{"ecr-staging"}, ""},
+		{"group and type", "staging", RegistryFilter{Type: "docker"}, nil, ""},
+		{"empty group", "empty", RegistryFilter{}, nil, ""},
+		{"unknown group", "production", RegistryFilter{}, nil, "group 'production' not found"},
+		{"unknown member", "broken", RegistryFilter{}, nil, "group 'broken' references unknown registry 'gone'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := config.SelectRegistries(tt.group, tt.filter)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupMembership(t *testing.T) {
+	config := selectorConfig()
+	config.AddToGroup("staging", "gar") // Already a member
+	config.AddToGroup("prod", "ecr-prod")
+	if !slices.Equal(config.Groups["staging"], []string{"gar", "ecr-staging"}) || !slices.Equal(config.Groups["prod"], []string{"ecr-prod"}) {
+		t.Errorf("got groups %v", config.Groups)
+	}
+
+	if err := config.RenameRegistry("ecr-staging", "ecr-eu"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(config.Groups["staging"], []string{"gar", "ecr-eu"}) {
+		t.Errorf("got staging %v after the rename", config.Groups["staging"])
+	}
+
+	config.RemoveRegistry("gar")
+	if !slices.Equal(config.Groups["staging"], []string{"ecr-eu"}) {
+		t.Errorf("got staging %v after the removal", config.Groups["staging"])
+	}
+
+	// Groups can be built from scratch
+	config = &Config{Registries: map[string]Registry{"hub": {Type: "docker"}}}
+	config.AddToGroup("all", "hub")
+	if keys, err := config.GroupRegistries("all"); err != nil || !slices.Equal(keys, []string{"hub"}) {
+		t.Errorf("got %v, %v", keys, err)
+	}
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+// DefaultConcurrency is the number of parallel logins used when none is given
+const DefaultConcurrency = 4
+
+// LoginResult holds the outcome of a single login performed in a batch
+type LoginResult struct {
+	Key       string
+	Registry  Registry
+	Duration  time.Duration
+	ExpiresAt time.Time
+	Err       error
+
+	passwordFrom string // Source of the password remembered after the login
+}
+
+// LoginToRegistries logs into every registry in keys, running at most concurrency
+// logins at the same time. Missing secrets (like docker passwords) are prompted
+// for up front so workers never need a terminal. The configuration is written
+// back once, after all workers are done, with the `LastLogin` and `ExpiresAt` of
+// every successful registry. With remember, passwords typed or configured in
+// plain text are moved to the keyring for the successful registries.
+func LoginToRegistries(ctx context.Context, configPath string, keys []string, concurrency int, remember bool) ([]LoginResult, error) {
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+
+	results, err := prepareLogins(ctx, config, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroPasswords(results)
+
+	err = ui.WithSpinner(fmt.Sprintf("Logging in to %d registries", len(keys)), func() error {
+		loginConcurrently(ctx, results, concurrency)
+		return nil
+	}, true)
+	if err != nil {
+		return results, err
+	}
+
+	if remember {
+		for i, result := range results {
+			if result.Err != nil || !canRemember(result.Registry) {
+				continue
+			}
+			passwordFrom, err := rememberRegistryPassword(ctx, result.Key, result.Registry)
+			if err != nil {
+				ui.PrintWarning(fmt.Sprintf("Failed to remember the password of %s: %v", result.Key, err))
+				continue
+			}
+			results[i].passwordFrom = passwordFrom
+		}
+	}
+	return results, saveLogins(ctx, configPath, results)
+}
+
+// prepareLogins validates the registries and reads or prompts for their missing secrets.
+// Problems are recorded on the result of the registry, only a cancelled prompt
+// aborts.
+func prepareLogins(ctx context.Context, config *Config, keys []string) ([]LoginResult, error) {
+	results := make([]LoginResult, len(keys))
+	for i, key := range keys {
+		registry, exists := config.Registries[key]
+		results[i] = LoginResult{Key: key, Registry: registry}
+		if !exists {
+			results[i].Err = fmt.Errorf("registry '%s' not found in the configuration", key)
+			continue
+		}
+		provider, err := GetProvider(registry.Type)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if err := provider.Validate(registry); err != nil {
+			results[i].Err = err
+			continue
+		}
+		if err := fillSecrets(ctx, key, provider, &results[i].Registry); err != nil {
+			if err.Error() == "operation cancelled by user" {
+				zeroPasswords(results)
+				return nil, err
+			}
+			results[i].Err = err
+		}
+	}
+	return results, nil
+}
+
+// EnsureLoggedIn logs into the registries in keys whose login is missing,
+// expired or expiring within margin, without any progress output. Registries
+// with a valid login are left out of the results, logged out ones are logged
+// into again.
+func EnsureLoggedIn(ctx context.Context, configPath string, keys []string, margin time.Duration) ([]LoginResult, error) {
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Looking at the status margin from now tells whether it expires within margin
+	at := time.Now().Add(margin)
+	var stale []string
+	for _, key := range keys {
+		registry, exists := config.Registries[key]
+		if status := registry.Status(at, 0); !exists || (status != StatusValid && status != StatusNoExpiry) {
+			stale = append(stale, key)
+		}
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+
+	results, err := prepareLogins(ctx, config, stale)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroPasswords(results)
+	loginConcurrently(ctx, results, DefaultConcurrency)
+	return results, saveLogins(ctx, configPath, results)
+}
+
+// zeroPasswords zeroes the passwords read by prepareLogins once the logins are done
+func zeroPasswords(results []LoginResult) {
+	for _, result := range results {
+		result.Registry.password.Zero()
+	}
+}
+
+// loginConcurrently runs the logins of every result without an error yet, at
+// most concurrency at a time, and fills in their outcome
+func loginConcurrently(ctx context.Context, results []LoginResult, concurrency int) {
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(result *LoginResult) {
+			defer wg.Done()
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				result.Err = ctx.Err()
+				return
+			}
+			defer func() { <-semaphore }()
+
+			start := time.Now()
+			result.ExpiresAt, result.Err = Login(ctx, result.Registry)
+			result.Duration = time.Since(start)
+		}(&results[i])
+	}
+	wg.Wait()
+}
+
+// saveLogins writes back the login date of every successful registry in one go,
+// on top of the latest configuration so edits made during the logins are kept.
+func saveLogins(ctx context.Context, configPath string, results []LoginResult) error {
+	succeeded := false
+	for _, result := range results {
+		if result.Err == nil {
+			succeeded = true
+		}
+	}
+	if !succeeded {
+		return nil
+	}
+
+	return UpdateConfig(ctx, configPath, func(config *Config) error {
+		now := time.Now()
+		for _, result := range results {
+			registry, exists := config.Registries[result.Key]
+			if result.Err != nil || !exists {
+				continue
+			}
+			if result.passwordFrom != "" {
+				registry.PasswordFrom = result.passwordFrom // Read the password from the keyring from now on
+				registry.Password = ""
+			}
+			registry.recordLogin(now, result.ExpiresAt)
+			config.Registries[result.Key] = registry
+		}
+		return nil
+	})
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const batchConfig = `version: 2
+registries:
+  first:
+    name: first
+    type: docker
+    url: first.example.com
+    username: me
+    password: hunter2
+  second:
+    name: second
+    type: docker
+    url: second.example.com
+    username: me
+    password: s3cret
+    ttl: 1h
+  invalid:
+    name: invalid
+    type: docker
+    username: me
+    password: hunter2
+  prompted:
+    name: prompted
+    type: docker
+    url: prompted.example.com
+    username: me
+`
+
+func TestLoginToRegistries(t *testing.T) {
+	configPath := testConfigPath(t)
+	dockerConfig := filepath.Join(t.TempDir(), "docker")
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+	t.Setenv(SecretStoreEnvVar, filepath.Join(t.TempDir(), "secrets.enc"))
+	t.Setenv(KeyringEnvVar, keyringFile)
+	withPassphrase(t, "correct horse")
+	writeTestFile(t, configPath, batchConfig)
+
+	keys := []string{"first", "invalid", "prompted", "gone", "second"}
+	results, err := LoginToRegistries(context.Background(), configPath, keys, 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantErrs := map[string]string{
+		"invalid":  "has no url defined",
+		"prompted": "no terminal is available to prompt for it",
+		"gone":     "not found in the configuration",
+	}
+	if len(results) != len(keys) {
+		t.Fatalf("got %d results for %d registries", len(results), len(keys))
+	}
+	for i, result := range results {
+		if result.Key != keys[i] {
+			t.Errorf("result %d is for %s, want %s", i, result.Key, keys[i])
+		}
+		want, failed := wantErrs[result.Key]
+		switch {
+		case failed && (result.Err == nil || !strings.Contains(result.Err.Error(), want)):
+			t.Errorf("%s: got %v, want an error containing %q", result.Key, result.Err, want)
+		case !failed && result.Err != nil:
+			t.Errorf("%s: %v", result.Key, result.Err)
+		}
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"first", "second"} {
+		registry := config.Registries[key]
+		if registry.LastLogin == "" {
+			t.Errorf("%s: the login was not saved", key)
+		}
+		// Remembered, the plain text passwords left the config file
+		if registry.Password != "" || registry.PasswordFrom != "store:"+key {
+			t.Errorf("%s: got password %q from %q, want it remembered", key, registry.Password, registry.PasswordFrom)
+		}
+	}
+	if config.Registries["second"].ExpiresAt == "" {
+		t.Error("the ttl of the login was not recorded")
+	}
+	for _, key := range []string{"invalid", "prompted"} {
+		if config.Registries[key].LastLogin != "" {
+			t.Errorf("%s: the failed login was saved", key)
+		}
+	}
+	auths := authsOf(t, readDockerConfig(t, filepath.Join(dockerConfig, "config.json")))
+	if len(auths) != 2 || auths["first.example.com"] == nil || auths["second.example.com"] == nil {
+		t.Errorf("got docker credentials for %v", auths)
+	}
+}
+
+func TestEnsureLoggedIn(t *testing.T) {
+	configPath := testConfigPath(t)
+	t.Setenv("DOCKER_CONFIG", filepath.Join(t.TempDir(), "docker"))
+	now := time.Now()
+	writeTestFile(t, configPath, batchConfig)
+	err := UpdateConfig(context.Background(), configPath, func(config *Config) error {
+		first, second := config.Registries["first"], config.Registries["second"]
+		first.recordLogin(now.Add(-time.Hour), time.Time{})
+		second.recordLogin(now.Add(-50*time.Minute), time.Time{}) // Expires in 10 minutes
+		config.Registries["first"], config.Registries["second"] = first, second
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the margin the login expiring soon is refreshed, the one without expiry is left alone
+	results, err := EnsureLoggedIn(context.Background(), configPath, []string{"first", "second"}, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Key != "second" || results[0].Err != nil {
+		t.Fatalf("got %+v, want only second logged into again", results)
+	}
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt, _ := config.Registries["second"].ExpiryTime(); expiresAt.Before(now.Add(50 * time.Minute)) {
+		t.Errorf("got expiry %s, want a new hour", expiresAt)
+	}
+
+	results, err = EnsureLoggedIn(context.Background(), configPath, []string{"first", "second"}, 15*time.Minute)
+	if err != nil || len(results) != 0 {
+		t.Errorf("got %+v, %v, want nothing to log into", results, err)
+	}
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+// Defaults of the refresh daemon
+const (
+	DefaultRefreshMargin = 15 * time.Minute
+	DefaultPollInterval  = 5 * time.Minute
+	DefaultRetryBackoff  = 30 * time.Second
+	DefaultMaxBackoff    = 30 * time.Minute
+)
+
+// maxMarginFraction caps the refresh margin to a fraction of the login lifetime,
+// so short-lived logins (a 10m ttl, a short JWT) are not due as soon as they are made
+const maxMarginFraction = 4
+
+// minRefreshInterval is the shortest time between two logins of a registry
+const minRefreshInterval = time.Minute
+
+// DaemonOptions configures RunDaemon
+type DaemonOptions struct {
+	Margin       time.Duration  // Re-login this long before a login expires
+	PollInterval time.Duration  // Longest wait between two reads of the configuration
+	RetryBackoff time.Duration  // Delay before retrying a failed login, doubled on every failure
+	MaxBackoff   time.Duration  // Longest delay between two retries
+	Concurrency  int            // Maximum number of parallel logins
+	Filter       RegistryFilter // Only refresh the registries matching the filter
+}
+
+// retryState tracks the failed logins of a registry
+type retryState struct {
+	failures int
+	retryAt  time.Time
+}
+
+// RunDaemon keeps the logins of the registries fresh until ctx is cancelled. The
+// configuration is read again on every iteration so edits are picked up without
+// a restart, and registries are logged into again Margin before they expire.
+// Failed logins are retried with a jittered exponential backoff.
+func RunDaemon(ctx context.Context, configPath string, opts DaemonOptions) error {
+	if opts.Margin <= 0 {
+		opts.Margin = DefaultRefreshMargin
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+	if opts.MaxBackoff < opts.RetryBackoff {
+		opts.MaxBackoff = max(DefaultMaxBackoff, opts.RetryBackoff)
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = DefaultConcurrency
+	}
+
+	retries := map[string]*retryState{}
+	for {
+		now := time.Now()
+		next := now.Add(opts.PollInterval)
+
+		config, err := LoadConfig(configPath)
+		if err != nil {
+			ui.PrintError("Failed to load config file", err, false)
+		} else {
+			var due []string
+			due, next = dueRegistries(config, opts, retries, now)
+			if len(due) > 0 {
+				refreshRegistries(ctx, configPath, config, due, opts, retries)
+				// Schedules changed, look at the configuration again right away
+				next = time.Now()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// dueRegistries returns the registries that need a login now, and when the next
+// one will be due
+func dueRegistries(config *Config, opts DaemonOptions, retries map[string]*retryState, now time.Time) ([]string, time.Time) {
+	var due []string
+	next := now.Add(opts.PollInterval)
+	for _, key := range config.FilterRegistries(opts.Filter) {
+		refreshAt, ok := refreshTime(config.Registries[key], opts.Margin, now)
+		if !ok {
+			continue
+		}
+		if retry, exists := retries[key]; exists && retry.retryAt.After(refreshAt) {
+			refreshAt = retry.retryAt
+		}
+		if !refreshAt.After(now) {
+			due = append(due, key)
+		} else if refreshAt.Before(next) {
+			next = refreshAt
+		}
+	}
+	return due, next
+}
+
+// refreshTime returns when the registry should be logged into again: margin
+// before it expires, at most a quarter of its lifetime and never sooner than
+// minRefreshInterval after the last login. Registries that cannot log in
+// without a prompt, whose login never expires or that were explicitly logged
+// out of are left alone.
+func refreshTime(registry Registry, margin time.Duration, now time.Time) (time.Time, bool) {
+	provider, err := GetProvider(registry.Type)
+	if err != nil || provider.Validate(registry) != nil {
+		return time.Time{}, false
+	}
+	for _, field := range RegistryFields(provider, registry) {
+		if field.Secret && field.Required && !registry.hasSecret(field.Name) {
+			return time.Time{}, false
+		}
+	}
+
+	if registry.LoggedOut() {
+		return time.Time{}, false
+	}
+	if registry.LastLogin == "" {
+		return now, true
+	}
+	expiresAt, ok := registry.ExpiryTime()
+	if !ok {
+		return time.Time{}, false
+	}
+	lastLogin, ok := parseTime(registry.LastLogin)
+	if !ok {
+		return expiresAt.Add(-margin), true
+	}
+	margin = min(margin, expiresAt.Sub(lastLogin)/maxMarginFraction)
+	earliest := lastLogin.Add(minRefreshInterval)
+	if refreshAt := expiresAt.Add(-margin); refreshAt.After(earliest) {
+		return refreshAt, true
+	}
+	return earliest, true
+}
+
+// refreshRegistries logs into the due registries and updates their retry state
+func refreshRegistries(ctx context.Context, configPath string, config *Config, keys []string, opts DaemonOptions, retries map[string]*retryState) {
+	results := make([]LoginResult, len(keys))
+	for i, key := range keys {
+		results[i] = LoginResult{Key: key, Registry: config.Registries[key]}
+	}
+	loginConcurrently(ctx, results, opts.Concurrency)
+
+	// Without the new expiry on disk the registries would be due again right away,
+	// so a failed save is retried like a failed login. The logins completed before
+	// the daemon was stopped are saved too.
+	saveErr := saveLogins(context.WithoutCancel(ctx), configPath, results)
+	if saveErr != nil {
+		ui.PrintError("Failed to save config file", saveErr, false)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, result := range results {
+		if result.Err == nil {
+			// Logins that do not tell when they expire last the ttl or the lifetime of their type
+			expiresAt := result.ExpiresAt
+			if lifetime := result.Registry.tokenLifetime(); expiresAt.IsZero() && lifetime > 0 {
+				expiresAt = now.Add(lifetime)
+			}
+			expiry := "never"
+			if !expiresAt.IsZero() {
+				expiry = formatTime(expiresAt)
+			}
+			ui.PrintSuccess("Refreshed login of", result.Key, "(expires "+expiry+")")
+			if saveErr == nil {
+				delete(retries, result.Key)
+				continue
+			}
+		}
+
+		retry, exists := retries[result.Key]
+		if !exists {
+			retry = &retryState{}
+			retries[result.Key] = retry
+		}
+		retry.failures++
+		retry.retryAt = now.Add(backoff(opts.RetryBackoff, opts.MaxBackoff, retry.failures))
+		if result.Err != nil {
+			ui.PrintError(fmt.Sprintf("Failed to refresh login of %s, retrying at %s", result.Key, formatTime(retry.retryAt)), result.Err, false)
+		}
+	}
+}
+
+// backoff returns the delay before the next retry: the base delay doubled on
+// every failure, capped and jittered so several daemons do not retry in lockstep
+func backoff(base, maxDelay time.Duration, failures int) time.Duration {
+	delay := base
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// daemonNow is the time the scheduling tests run at
+var daemonNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+
+// loggedIn returns a docker registry logged into ago before daemonNow
+func loggedIn(ttl string, ago time.Duration) Registry {
+	return Registry{Name: "hub", Type: "docker", URL: "registry.example.com", Username: "me", Password: "hunter2",
+		TTL: ttl, LastLogin: formatTime(daemonNow.Add(-ago))}
+}
+
+func TestRefreshTime(t *testing.T) {
+	margin := 15 * time.Minute
+	ecr := Registry{Name: "ecr", Type: "aws", URL: "123456789012.dkr.ecr.us-west-2.amazonaws.com", Region: "us-west-2",
+		LastLogin: formatTime(daemonNow.Add(-time.Hour))}
+	loggedOut := loggedIn("12h", time.Hour)
+	loggedOut.LastLogout = formatTime(daemonNow)
+	badLogin := loggedIn("", 0)
+	badLogin.LastLogin, badLogin.ExpiresAt = "yesterday", formatTime(daemonNow.Add(time.Hour))
+	noPassword := loggedIn("12h", time.Hour)
+	noPassword.Password = ""
+	invalid := loggedIn("12h", time.Hour)
+	invalid.URL = ""
+
+	tests := []struct {
+		name     string
+		registry Registry
+		want     time.Duration // Refresh time after daemonNow
+		wantOK   bool
+	}{
+		{"never logged in", Registry{Name: "hub", Type: "docker", URL: "registry.example.com", Username: "me", Password: "hunter2"}, 0, true},
+		{"margin before the expiry", loggedIn("12h", time.Hour), 11*time.Hour - margin, true},
+		{"expired", loggedIn("1h", 2*time.Hour), -time.Hour - margin, true},
+		{"lifetime of the type", ecr, 11*time.Hour - margin, true},
+		{"margin clamped to a quarter of the lifetime", loggedIn("10m", 0), 10*time.Minute - 10*time.Minute/maxMarginFraction, true},
+		{"no sooner than the minimum interval", loggedIn("1m", 0), minRefreshInterval, true},
+		{"unparsable last login", badLogin, time.Hour - margin, true},
+		{"no expiry", loggedIn("", time.Hour), 0, false},
+		{"logged out", loggedOut, 0, false},
+		{"password to prompt for", noPassword, 0, false},
+		{"invalid registry", invalid, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := refreshTime(tt.registry, margin, daemonNow)
+			if ok != tt.wantOK {
+				t.Fatalf("got due %v, want %v", ok, tt.wantOK)
+			}
+			if ok && !got.Equal(daemonNow.Add(tt.want)) {
+				t.Errorf("got refresh in %s, want in %s", got.Sub(daemonNow), tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration // Delay before the jitter
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{7, 30 * time.Minute}, // 32 minutes, capped
+		{1000, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		for range 50 {
+			got := backoff(30*time.Second, 30*time.Minute, tt.failures)
+			if got < tt.want/2 || got > tt.want {
+				t.Fatalf("%d failures: got %s, want between %s and %s", tt.failures, got, tt.want/2, tt.want)
+			}
+		}
+	}
+}
+
+func TestDueRegistries(t *testing.T) {
+	fresh := Registry{Name: "fresh", Type: "docker", URL: "fresh.example.com", Username: "me", Password: "hunter2"}
+	retried := fresh
+	retried.Name, retried.URL = "retried", "retried.example.com"
+	soon := loggedIn("20m", 0) // Due in 15m, the margin being clamped to 5m
+	soon.Name = "soon"
+	later := loggedIn("12h", 0)
+	later.Name = "later"
+	other := fresh
+	other.Name, other.Tags = "other", []string{"elsewhere"}
+	config := &Config{Registries: map[string]Registry{"fresh": fresh, "retried": retried, "soon": soon, "later": later, "other": other}}
+
+	opts := DaemonOptions{Margin: DefaultRefreshMargin, PollInterval: time.Hour}
+	retries := map[string]*retryState{"retried": {failures: 1, retryAt: daemonNow.Add(2 * time.Minute)}}
+	due, next := dueRegistries(config, opts, retries, daemonNow)
+	if !slices.Equal(due, []string{"fresh", "other"}) {
+		t.Errorf("got due %v, want the registries never logged in without a pending retry", due)
+	}
+	if !next.Equal(daemonNow.Add(2 * time.Minute)) {
+		t.Errorf("got next pass in %s, want at the retry", next.Sub(daemonNow))
+	}
+
+	opts.Filter = RegistryFilter{Tag: "elsewhere"}
+	due, next = dueRegistries(config, opts, nil, daemonNow)
+	if !slices.Equal(due, []string{"other"}) || !next.Equal(daemonNow.Add(time.Hour)) {
+		t.Errorf("got due %v and next pass in %s, want only the filtered registry and the poll interval", due, next.Sub(daemonNow))
+	}
+
+	delete(config.Registries, "fresh")
+	delete(config.Registries, "other")
+	due, next = dueRegistries(config, opts, retries, daemonNow)
+	if len(due) != 0 || !next.Equal(daemonNow.Add(time.Hour)) {
+		t.Errorf("got due %v and next pass in %s, want none before the poll interval", due, next.Sub(daemonNow))
+	}
+}
+
+// A refresh pass stopped by the daemon still records the logins it completed
+func TestRefreshRegistriesSavesCompletedLogins(t *testing.T) {
+	configPath := testConfigPath(t)
+	t.Setenv("DOCKER_CONFIG", filepath.Join(t.TempDir(), "docker"))
+	writeTestFile(t, configPath, `version: 2
+registries:
+  fast:
+    name: fast
+    type: docker
+    url: fast.example.com
+    username: me
+    password: hunter2
+  slow:
+    name: slow
+    type: docker
+    url: slow.example.com
+    username: me
+    password_from: "cmd:exec sleep 30"
+`)
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	retries := map[string]*retryState{}
+	opts := DaemonOptions{Concurrency: 2, RetryBackoff: DefaultRetryBackoff, MaxBackoff: DefaultMaxBackoff}
+	refreshRegistries(ctx, configPath, config, []string{"fast", "slow"}, opts, retries)
+
+	config, err = LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Registries["fast"].LastLogin == "" {
+		t.Error("the completed login was not saved")
+	}
+	if config.Registries["slow"].LastLogin != "" {
+		t.Error("the cancelled login was saved")
+	}
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// dockerHubServer is the key Docker uses for Docker Hub credentials
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// CredentialHelperName is the name auth-refresher answers to as a Docker
+// credential helper, i.e. the binary is called docker-credential-auth-refresher
+const CredentialHelperName = "auth-refresher"
+
+// dockerConfigMu serializes the updates of the Docker configuration file made by
+// concurrent logins of this process, the file lock serializing them with other
+// processes
+var dockerConfigMu sync.Mutex
+
+// DockerConfigPath returns the path of the Docker CLI configuration file,
+// honouring the DOCKER_CONFIG environment variable
+func DockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".docker", "config.json")
+}
+
+// DockerServerKey converts a registry URL to the key Docker stores its credentials under
+func DockerServerKey(url string) string {
+	host := normalizeURL(url)
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	switch host {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return dockerHubServer
+	}
+	return host
+}
+
+// dockerConfig is the Docker CLI configuration file. Only the keys auth-refresher
+// needs are decoded, everything else is kept untouched in raw.
+type dockerConfig struct {
+	path        string
+	raw         map[string]json.RawMessage
+	auths       map[string]json.RawMessage
+	credsStore  string
+	credHelpers map[string]string
+}
+
+// loadDockerConfig reads the Docker configuration, returning an empty one if the file does not exist
+func loadDockerConfig(path string) (*dockerConfig, error) {
+	config := &dockerConfig{
+		path:        path,
+		raw:         map[string]json.RawMessage{},
+		auths:       map[string]json.RawMessage{},
+		credHelpers: map[string]string{},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read docker config: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return config, nil
+	}
+
+	if err := json.Unmarshal(data, &config.raw); err != nil {
+		return nil, fmt.Errorf("failed to parse docker config %s: %w", path, err)
+	}
+	if auths, ok := config.raw["auths"]; ok {
+		if err := json.Unmarshal(auths, &config.auths); err != nil {
+			return nil, fmt.Errorf("failed to parse auths in docker config: %w", err)
+		}
+	}
+	if credsStore, ok := config.raw["credsStore"]; ok {
+		if err := json.Unmarshal(credsStore, &config.credsStore); err != nil {
+			return nil, fmt.Errorf("failed to parse credsStore in docker config: %w", err)
+		}
+	}
+	if credHelpers, ok := config.raw["credHelpers"]; ok {
+		if err := json.Unmarshal(credHelpers, &config.credHelpers); err != nil {
+			return nil, fmt.Errorf("failed to parse credHelpers in docker config: %w", err)
+		}
+	}
+	return config, nil
+}
+
+// helperFor returns the credential helper configured for the server, if any
+func (c *dockerConfig) helperFor(server string) string {
+	if helper, ok := c.credHelpers[server]; ok {
+		return helper
+	}
+	return c.credsStore
+}
+
+// save writes the configuration back through a temporary file so a crash never leaves it half written
+func (c *dockerConfig) save() error {
+	auths, err := json.Marshal(c.auths)
+	if err != nil {
+		return err
+	}
+	c.raw["auths"] = auths
+
+	data, err := json.MarshalIndent(c.raw, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode docker config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create docker config directory: %w", err)
+	}
+
+	if err := writeFileAtomic(c.path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write docker config: %w", err)
+	}
+	return nil
+}
+
+// lockDockerConfig locks the Docker configuration file until the returned
+// function is called, so a read-modify-write cycle does not lose concurrent updates
+func lockDockerConfig(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create docker config directory: %w", err)
+	}
+	dockerConfigMu.Lock()
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		dockerConfigMu.Unlock()
+		return nil, fmt.Errorf("failed to lock the docker config: %w", err)
+	}
+	return func() {
+		unlock()
+		dockerConfigMu.Unlock()
+	}, nil
+}
+
+// StoreDockerCredential saves a credential for the registry URL the same way
+// `docker login` would: through the configured credential helper, or as an
+// `auths` entry in the Docker configuration file otherwise. It does not need the
+// docker binary.
+func StoreDockerCredential(ctx context.Context, url, username string, password *secret.Secret) error {
+	path := DockerConfigPath()
+	unlock, err := lockDockerConfig(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	config, err := loadDockerConfig(path)
+	if err != nil {
+		return err
+	}
+
+	server := DockerServerKey(url)
+	helper := config.helperFor(server)
+	if helper == CredentialHelperName {
+		// Docker asks us for the credential on demand, nothing to store
+		return nil
+	}
+	if helper != "" {
+		payload, err := json.Marshal(map[string]string{
+			"ServerURL": server,
+			"Username":  username,
+			"Secret":    password.Reveal(),
+		})
+		if err != nil {
+			return err
+		}
+		defer clear(payload)
+		return runCredentialHelper(ctx, helper, "store", payload)
+	}
+
+	pair := append([]byte(username+":"), password.Bytes()...)
+	defer clear(pair)
+	entry, err := json.Marshal(map[string]string{
+		"auth": base64.StdEncoding.EncodeToString(pair),
+	})
+	if err != nil {
+		return err
+	}
+	config.auths[server] = entry
+	return config.save()
+}
+
+// EraseDockerCredential removes the stored credential of the registry URL,
+// through the credential helper or from the Docker configuration file
+func EraseDockerCredential(ctx context.Context, url string) error {
+	path := DockerConfigPath()
+	unlock, err := lockDockerConfig(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	config, err := loadDockerConfig(path)
+	if err != nil {
+		return err
+	}
+
+	server := DockerServerKey(url)
+	if helper := config.helperFor(server); helper != "" && helper != CredentialHelperName {
+		if err := runCredentialHelper(ctx, helper, "erase", []byte(server)); err != nil {
+			return err
+		}
+	}
+
+	// Older docker versions stored entries with the scheme, remove those too
+	removed := false
+	for key := range config.auths {
+		if DockerServerKey(key) == server {
+			delete(config.auths, key)
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+	return config.save()
+}
+
+// runCredentialHelper runs `docker-credential-<helper> <action>` with the payload on stdin
+func runCredentialHelper(ctx context.Context, helper, action string, payload []byte) error {
+	binary := "docker-credential-" + helper
+	cmd := exec.CommandContext(ctx, binary, action)
+	cmd.Stdin = bytes.NewReader(payload)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(output.String()); msg != "" {
+			return fmt.Errorf("%s %s failed: %s", binary, action, msg)
+		}
+		return fmt.Errorf("%s %s failed: %w", binary, action, err)
+	}
+	return nil
+}
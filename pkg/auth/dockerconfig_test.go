@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// testDockerConfig points DOCKER_CONFIG at a temporary directory and writes
+// content to its config.json, unless content is nil
+func testDockerConfig(t *testing.T, content *string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "docker")
+	t.Setenv("DOCKER_CONFIG", dir)
+	path := filepath.Join(dir, "config.json")
+	if content != nil {
+		writeTestFile(t, path, *content)
+	}
+	return path
+}
+
+// readDockerConfig decodes the top level keys of the Docker configuration file
+func readDockerConfig(t *testing.T, path string) map[string]json.RawMessage {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("invalid docker config: %v\n%s", err, data)
+	}
+	return raw
+}
+
+// authsOf decodes the auths of the Docker configuration file
+func authsOf(t *testing.T, raw map[string]json.RawMessage) map[string]map[string]string {
+	t.Helper()
+	auths := map[string]map[string]string{}
+	if err := json.Unmarshal(raw["auths"], &auths); err != nil {
+		t.Fatal(err)
+	}
+	return auths
+}
+
+func TestDockerCredentialKeepsOtherKeys(t *testing.T) {
+	content := `{
+	"auths": {
+		"other.example.com": {"auth": "b3RoZXI6cGFzcw=="},
+		"https://registry.example.com": {"auth": "b2xkOm9sZA=="}
+	},
+	"credHelpers": {"gcr.io": "gcloud"},
+	"proxies": {"default": {"httpProxy": "http://proxy.example.com:3128"}},
+	"currentContext": "remote"
+}`
+	path := testDockerConfig(t, &content)
+	before := readDockerConfig(t, path)
+	ctx := context.Background()
+
+	password := secret.FromString("hunter2")
+	if err := StoreDockerCredential(ctx, "registry.example.com", "me", password); err != nil {
+		t.Fatal(err)
+	}
+	after := readDockerConfig(t, path)
+	for _, key := range []string{"credHelpers", "proxies", "currentContext"} {
+		if !jsonEqual(t, before[key], after[key]) {
+			t.Errorf("%s changed from %s to %s", key, before[key], after[key])
+		}
+	}
+	auths := authsOf(t, after)
+	if auths["other.example.com"]["auth"] != "b3RoZXI6cGFzcw==" {
+		t.Errorf("the credential of another registry changed: %v", auths["other.example.com"])
+	}
+	if want := base64.StdEncoding.EncodeToString([]byte("me:hunter2")); auths["registry.example.com"]["auth"] != want {
+		t.Errorf("got auths %v, want registry.example.com stored", auths)
+	}
+
+	// Erasing also removes the entry stored with a scheme by older versions of docker
+	if err := EraseDockerCredential(ctx, "https://registry.example.com/v2/"); err != nil {
+		t.Fatal(err)
+	}
+	after = readDockerConfig(t, path)
+	for _, key := range []string{"credHelpers", "proxies", "currentContext"} {
+		if !jsonEqual(t, before[key], after[key]) {
+			t.Errorf("%s changed from %s to %s", key, before[key], after[key])
+		}
+	}
+	if auths := authsOf(t, after); len(auths) != 1 || auths["other.example.com"] == nil {
+		t.Errorf("got auths %v, want only the other registry", auths)
+	}
+}
+
+// jsonEqual compares two JSON values regardless of their formatting
+func jsonEqual(t *testing.T, a, b json.RawMessage) bool {
+	t.Helper()
+	var x, y any
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func TestDockerCredentialThroughHelper(t *testing.T) {
+	// A fake credential helper recording what it was asked
+	bin := t.TempDir()
+	record := filepath.Join(t.TempDir(), "record")
+	writeTestFile(t, filepath.Join(bin, "docker-credential-fake"), "#!/bin/sh\n{ echo \"$1\"; cat; echo; } >> "+record+"\n")
+	if err := os.Chmod(filepath.Join(bin, "docker-credential-fake"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	content := `{"credsStore": "fake", "credHelpers": {"served.example.com": "` + CredentialHelperName + `"}}`
+	path := testDockerConfig(t, &content)
+	ctx := context.Background()
+	password := secret.FromString("hunter2")
+	if err := StoreDockerCredential(ctx, "registry.example.com", "me", password); err != nil {
+		t.Fatal(err)
+	}
+	if err := EraseDockerCredential(ctx, "registry.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	// auth-refresher itself serves this one on demand, so nothing is stored
+	if err := StoreDockerCredential(ctx, "served.example.com", "me", password); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "store\n" + `{"Secret":"hunter2","ServerURL":"registry.example.com","Username":"me"}` + "\nerase\nregistry.example.com\n"
+	if string(got) != want {
+		t.Errorf("the helper got\n%s\nwant\n%s", got, want)
+	}
+	if data, _ := os.ReadFile(path); string(data) != content {
+		t.Errorf("the docker config changed:\n%s", data)
+	}
+}
+
+func TestDockerCredentialNewFile(t *testing.T) {
+	empty := "  \n"
+	tests := []struct {
+		name    string
+		content *string
+	}{
+		{"missing file", nil},
+		{"empty file", &empty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := testDockerConfig(t, tt.content)
+			ctx := context.Background()
+			// Nothing to erase in a missing or empty file
+			if err := EraseDockerCredential(ctx, "registry.example.com"); err != nil {
+				t.Fatal(err)
+			}
+			if err := StoreDockerCredential(ctx, "registry.example.com", "me", secret.FromString("hunter2")); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm != 0600 {
+				t.Errorf("got file permissions %s, want -rw-------", perm)
+			}
+			if tt.content == nil {
+				dir, err := os.Stat(filepath.Dir(path))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if perm := dir.Mode().Perm(); perm != 0700 {
+					t.Errorf("got directory permissions %s, want drwx------", perm)
+				}
+			}
+			if auths := authsOf(t, readDockerConfig(t, path)); len(auths) != 1 || auths["registry.example.com"] == nil {
+				t.Errorf("got auths %v", auths)
+			}
+		})
+	}
+}
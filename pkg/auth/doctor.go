@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CheckSeverity tells how serious a doctor finding is
+type CheckSeverity int
+
+// Severities of doctor findings
+const (
+	CheckOK CheckSeverity = iota
+	CheckWarning
+	CheckError
+)
+
+// CheckResult is a single finding of the doctor checks
+type CheckResult struct {
+	Severity CheckSeverity
+	Subject  string // What was checked, e.g. a registry key or a binary
+	Message  string
+	Hint     string // How to fix the problem
+}
+
+// versionPattern finds the first dotted version number in a version output
+var versionPattern = regexp.MustCompile(`\d+\.\d+(?:\.\d+)?`)
+
+// CheckConfig looks for problems in the registry definitions and the
+// permissions of the configuration and state files
+func CheckConfig(configPath string, config *Config) []CheckResult {
+	var results []CheckResult
+	results = append(results, checkPermissions("config file", configPath)...)
+	results = append(results, checkPermissions("state file", StatePath(configPath))...)
+	if project := ProjectConfigPath(); project != "" && absPath(project) != absPath(configPath) && !IsTrustedConfig(project) {
+		if _, err := os.Stat(project); err == nil {
+			results = append(results, CheckResult{
+				Severity: CheckWarning,
+				Subject:  ProjectConfigName,
+				Message:  "the project-local config file of this directory is ignored until trusted",
+				Hint:     "run `auth-refresher trust` to use it, or name it with --config",
+			})
+		}
+	}
+
+	keys := config.FilterRegistries(RegistryFilter{})
+	urls := map[string][]string{}
+	for _, key := range keys {
+		registry := config.Registries[key]
+		findings := checkRegistry(key, registry)
+		if len(findings) == 0 {
+			findings = append(findings, CheckResult{Severity: CheckOK, Subject: key, Message: "registry definition is valid"})
+		}
+		results = append(results, findings...)
+
+		if url := registry.ServerURL(); url != "" {
+			id := registry.Type + " " + DockerServerKey(url)
+			urls[id] = append(urls[id], key)
+		}
+	}
+
+	duplicates := make([]string, 0, len(urls))
+	for id, keys := range urls {
+		if len(keys) > 1 {
+			duplicates = append(duplicates, id)
+		}
+	}
+	sort.Strings(duplicates)
+	for _, id := range duplicates {
+		registryType, url, _ := strings.Cut(id, " ")
+		results = append(results, CheckResult{
+			Severity: CheckWarning,
+			Subject:  strings.Join(urls[id], ", "),
+			Message:  fmt.Sprintf("%s registries share the URL %s", registryType, url),
+			Hint:     "remove the duplicates with `auth-refresher remove`",
+		})
+	}
+
+	for group, members := range config.Groups {
+		for _, member := range members {
+			if _, exists := config.Registries[member]; !exists {
+				results = append(results, CheckResult{
+					Severity: CheckError,
+					Subject:  "group " + group,
+					Message:  fmt.Sprintf("references unknown registry '%s'", member),
+					Hint:     "remove it from the group in the config file",
+				})
+			}
+		}
+	}
+
+	return results
+}
+
+// checkRegistry validates a single registry definition
+func checkRegistry(key string, registry Registry) []CheckResult {
+	var results []CheckResult
+	if registry.Type == "" {
+		return append(results, CheckResult{
+			Severity: CheckError,
+			Subject:  key,
+			Message:  "no type defined",
+			Hint:     fmt.Sprintf("set one of %s with `auth-refresher edit %s --set type=...`", strings.Join(ProviderTypes(), ", "), key),
+		})
+	}
+	provider, err := GetProvider(registry.Type)
+	if err != nil {
+		return append(results, CheckResult{
+			Severity: CheckError,
+			Subject:  key,
+			Message:  err.Error(),
+			Hint:     fmt.Sprintf("supported types are %s", strings.Join(ProviderTypes(), ", ")),
+		})
+	}
+	if registry.ServerURL() == "" {
+		results = append(results, CheckResult{
+			Severity: CheckError,
+			Subject:  key,
+			Message:  "no URL defined",
+			Hint:     fmt.Sprintf("set it with `auth-refresher edit %s --set url=...`", key),
+		})
+	} else if err := provider.Validate(registry); err != nil {
+		results = append(results, CheckResult{
+			Severity: CheckError,
+			Subject:  key,
+			Message:  err.Error(),
+			Hint:     fmt.Sprintf("fix it with `auth-refresher edit %s`", key),
+		})
+	}
+
+	if account, region, ok := ParseECRURL(registry.URL); ok {
+		if registry.Region != "" && region != registry.Region {
+			results = append(results, CheckResult{
+				Severity: CheckError,
+				Subject:  key,
+				Message:  fmt.Sprintf("ECR URL is in region %s but the registry region is %s", region, registry.Region),
+				Hint:     fmt.Sprintf("run `auth-refresher edit %s --set region=%s`", key, region),
+			})
+		}
+		if registry.AccountID != "" && account != registry.AccountID {
+			results = append(results, CheckResult{
+				Severity: CheckError,
+				Subject:  key,
+				Message:  fmt.Sprintf("ECR URL belongs to account %s but the registry account_id is %s", account, registry.AccountID),
+				Hint:     fmt.Sprintf("run `auth-refresher edit %s --set account_id=%s`", key, account),
+			})
+		}
+	}
+	if registry.Name != "" && registry.Name != key {
+		results = append(results, CheckResult{
+			Severity: CheckWarning,
+			Subject:  key,
+			Message:  fmt.Sprintf("name '%s' differs from the registry key", registry.Name),
+			Hint:     fmt.Sprintf("run `auth-refresher edit %s --set name=%s` or rename the key with --rename", key, key),
+		})
+	}
+	if registry.TTL != "" {
+		if _, err := time.ParseDuration(registry.TTL); err != nil {
+			results = append(results, CheckResult{
+				Severity: CheckError,
+				Subject:  key,
+				Message:  fmt.Sprintf("invalid ttl '%s'", registry.TTL),
+				Hint:     "use a duration such as 12h or 30m",
+			})
+		}
+	}
+	return results
+}
+
+// checkPermissions warns about files readable by other users
+func checkPermissions(label, path string) []CheckResult {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if info.Mode().Perm()&0o044 != 0 {
+		return []CheckResult{{
+			Severity: CheckWarning,
+			Subject:  label,
+			Message:  fmt.Sprintf("%s is readable by other users (%s)", path, info.Mode().Perm()),
+			Hint:     fmt.Sprintf("run `chmod 600 %s`", path),
+		}}
+	}
+	return []CheckResult{{Severity: CheckOK, Subject: label, Message: fmt.Sprintf("%s is only readable by you", path)}}
+}
+
+// CheckTools verifies the programs needed by the registries are on PATH and
+// recent enough
+func CheckTools(ctx context.Context, config *Config) []CheckResult {
+	tools := map[string]Tool{}
+	users := map[string][]string{}
+	for _, key := range config.FilterRegistries(RegistryFilter{}) {
+		registry := config.Registries[key]
+		registryType := registry.Type
+		provider, err := GetProvider(registryType)
+		if err != nil {
+			continue
+		}
+		toolProvider, ok := provider.(ToolProvider)
+		if !ok {
+			continue
+		}
+		for _, tool := range toolProvider.Tools(registry) {
+			tools[tool.Name] = tool
+			if !slices.Contains(users[tool.Name], registryType) {
+				users[tool.Name] = append(users[tool.Name], registryType)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var results []CheckResult
+	for _, name := range names {
+		results = append(results, checkTool(ctx, tools[name], users[name]))
+	}
+	return results
+}
+
+// checkTool looks the tool up on PATH and compares its version with the minimum
+func checkTool(ctx context.Context, tool Tool, usedBy []string) CheckResult {
+	neededBy := fmt.Sprintf("needed by %s registries", strings.Join(usedBy, ", "))
+	path, err := exec.LookPath(tool.Name)
+	if err != nil {
+		return CheckResult{
+			Severity: CheckError,
+			Subject:  tool.Name,
+			Message:  "not found on PATH, " + neededBy,
+			Hint:     fmt.Sprintf("install %s or add it to your PATH", tool.Name),
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, tool.VersionArgs...).CombinedOutput()
+	if err != nil {
+		return CheckResult{
+			Severity: CheckError,
+			Subject:  tool.Name,
+			Message:  fmt.Sprintf("%s %s failed: %v", path, strings.Join(tool.VersionArgs, " "), err),
+			Hint:     fmt.Sprintf("check that %s works from your shell", tool.Name),
+		}
+	}
+
+	version := versionPattern.FindString(string(output))
+	if tool.MinVersion != "" && (version == "" || compareVersions(version, tool.MinVersion) < 0) {
+		return CheckResult{
+			Severity: CheckError,
+			Subject:  tool.Name,
+			Message:  fmt.Sprintf("version %s is older than the required %s", version, tool.MinVersion),
+			Hint:     fmt.Sprintf("upgrade %s to %s or later", tool.Name, tool.MinVersion),
+		}
+	}
+	return CheckResult{Severity: CheckOK, Subject: tool.Name, Message: fmt.Sprintf("%s version %s found at %s", tool.Name, version, path)}
+}
+
+// compareVersions compares two dotted version numbers, returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckToolsPerRegistry(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	tests := []struct {
+		name     string
+		registry Registry
+		want     []string
+	}{
+		{"gcloud source", Registry{Type: "gcp", URL: "gcr.io"}, []string{"gcloud"}},
+		{"key source", Registry{Type: "gcp", URL: "gcr.io", TokenSource: gcpSourceKey}, nil},
+		{"metadata source", Registry{Type: "gcp", URL: "gcr.io", TokenSource: gcpSourceMetadata}, nil},
+		{"helm", Registry{Type: "helm", Auth: helmAuthBasic, URL: "oci://charts.example.com"}, []string{"helm"}},
+		{"docker", Registry{Type: "docker", URL: "registry.example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Registries: map[string]Registry{"registry": tt.registry}}
+			results := CheckTools(context.Background(), config)
+			if len(results) != len(tt.want) {
+				t.Fatalf("got %v, want checks of %v", results, tt.want)
+			}
+			for i, result := range results {
+				if result.Subject != tt.want[i] || result.Severity != CheckError {
+					t.Errorf("got %v, want %s missing", result, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRegistry(t *testing.T) {
+	ecrURL := "123456789012.dkr.ecr.us-west-2.amazonaws.com"
+	tests := []struct {
+		name     string
+		key      string
+		registry Registry
+		want     []CheckResult // Only Severity and Message are compared
+	}{
+		{"valid", "ecr", Registry{Name: "ecr", Type: "aws", URL: ecrURL, Region: "us-west-2", AccountID: "123456789012"}, nil},
+		{"no type", "hub", Registry{URL: "registry.example.com"}, []CheckResult{
+			{Severity: CheckError, Message: "no type defined"},
+		}},
+		{"unknown type", "hub", Registry{Type: "quay", URL: "quay.io"}, []CheckResult{
+			{Severity: CheckError, Message: "unsupported registry type: quay"},
+		}},
+		{"no url", "hub", Registry{Type: "docker", Username: "me"}, []CheckResult{
+			{Severity: CheckError, Message: "no URL defined"},
+		}},
+		{"region mismatch", "ecr", Registry{Type: "aws", URL: ecrURL, Region: "eu-west-1"}, []CheckResult{
+			{Severity: CheckError, Message: "ECR URL is in region us-west-2 but the registry region is eu-west-1"},
+		}},
+		{"account mismatch", "ecr", Registry{Type: "aws", URL: ecrURL, Region: "us-west-2", AccountID: "210987654321"}, []CheckResult{
+			{Severity: CheckError, Message: "ECR URL belongs to account 123456789012 but the registry account_id is 210987654321"},
+		}},
+		{"name differs from the key", "hub", Registry{Name: "dockerhub", Type: "docker", URL: "registry.example.com", Username: "me"}, []CheckResult{
+			{Severity: CheckWarning, Message: "name 'dockerhub' differs from the registry key"},
+		}},
+		{"invalid ttl", "hub", Registry{Type: "docker", URL: "registry.example.com", Username: "me", TTL: "a day"}, []CheckResult{
+			{Severity: CheckError, Message: "invalid ttl 'a day'"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkRegistry(tt.key, tt.registry)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i, result := range got {
+				if result.Severity != tt.want[i].Severity || !strings.Contains(result.Message, tt.want[i].Message) ||
+					result.Subject != tt.key || result.Hint == "" {
+					t.Errorf("got %+v, want %+v with a hint", result, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	configPath := testConfigPath(t)
+	writeTestFile(t, configPath, "version: 2\n")
+	if err := os.Chmod(configPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	inDir(t, t.TempDir())
+	writeTestFile(t, ProjectConfigName, "version: 2\n")
+	config := &Config{
+		Registries: map[string]Registry{
+			"a": {Name: "a", Type: "docker", URL: "registry.example.com", Username: "me"},
+			"b": {Name: "b", Type: "docker", URL: "https://registry.example.com/v2/", Username: "me"},
+		},
+		Groups: map[string][]string{"team": {"a", "gone"}},
+	}
+
+	results := CheckConfig(configPath, config)
+	want := []CheckResult{
+		{Severity: CheckWarning, Subject: "config file", Message: "is readable by other users"},
+		{Severity: CheckWarning, Subject: ProjectConfigName, Message: "ignored until trusted"},
+		{Severity: CheckOK, Subject: "a", Message: "registry definition is valid"},
+		{Severity: CheckOK, Subject: "b", Message: "registry definition is valid"},
+		{Severity: CheckWarning, Subject: "a, b", Message: "docker registries share the URL registry.example.com"},
+		{Severity: CheckError, Subject: "group team", Message: "references unknown registry 'gone'"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %+v, want %+v", results, want)
+	}
+	for i, result := range results {
+		if result.Severity != want[i].Severity || result.Subject != want[i].Subject || !strings.Contains(result.Message, want[i].Message) {
+			t.Errorf("got %+v, want %+v", result, want[i])
+		}
+	}
+}
+
+func TestCheckToolVersion(t *testing.T) {
+	bin := t.TempDir()
+	writeTestFile(t, filepath.Join(bin, "helm"), "#!/bin/sh\necho 'v3.7.2+g663a896'\n")
+	if err := os.Chmod(filepath.Join(bin, "helm"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		min  string
+		want CheckSeverity
+	}{
+		{"3.8.0", CheckError},
+		{"3.7.2", CheckOK},
+		{"3.7", CheckOK},
+		{"", CheckOK},
+	}
+	for _, tt := range tests {
+		result := checkTool(context.Background(), Tool{Name: "helm", VersionArgs: []string{"version"}, MinVersion: tt.min}, []string{"helm"})
+		if result.Severity != tt.want {
+			t.Errorf("minimum version %q: got %+v", tt.min, result)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"3.8.0", "3.8.0", 0},
+		{"3.8", "3.8.0", 0},
+		{"3.10.0", "3.9.1", 1},
+		{"1.17.9", "1.17.10", -1},
+		{"2.0", "1.99.99", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// encryptedPrefix marks the encrypted values of a configuration file
+const encryptedPrefix = "enc:v1:"
+
+// encryptionKDF is the key derivation function of encrypted configuration files
+const encryptionKDF = "pbkdf2-sha256"
+
+// sensitiveFields are the registry fields encrypted at rest when the
+// configuration file is encrypted. Every other field stays readable.
+var sensitiveFields = []string{FieldPassword}
+
+// Encryption holds how the sensitive fields of a configuration file are
+// encrypted. The key is derived once per file from the passphrase and the salt.
+type Encryption struct {
+	KDF        string `yaml:"kdf"`
+	Iterations int    `yaml:"iterations"`
+	Salt       string `yaml:"salt"` // Base64 encoded
+}
+
+// NewEncryption returns the settings to encrypt a configuration file with a new salt
+func NewEncryption() (*Encryption, error) {
+	salt, err := secret.NewSalt()
+	if err != nil {
+		return nil, err
+	}
+	return &Encryption{KDF: encryptionKDF, Iterations: secret.KeyIterations, Salt: base64.StdEncoding.EncodeToString(salt)}, nil
+}
+
+// salt returns the decoded salt of the file
+func (e *Encryption) salt() ([]byte, error) {
+	if e.KDF != encryptionKDF || e.Iterations <= 0 {
+		return nil, fmt.Errorf("config file is encrypted with an unsupported key derivation (%s, %d iterations)", e.KDF, e.Iterations)
+	}
+	salt, err := base64.StdEncoding.DecodeString(e.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("config file has an invalid encryption salt")
+	}
+	return salt, nil
+}
+
+// key returns a copy of the key of the file, see derivedKey
+func (e *Encryption) key(ctx context.Context, confirm bool) (*secret.Secret, error) {
+	salt, err := e.salt()
+	if err != nil {
+		return nil, err
+	}
+	key, err := derivedKey(ctx, salt, e.Iterations, confirm)
+	if err != nil {
+		return nil, fmt.Errorf("passphrase of the config file needed: %w", err)
+	}
+	return key, nil
+}
+
+// forgetKey drops the cached key of the file, e.g. after it failed to decrypt a value
+func (e *Encryption) forgetKey() {
+	if salt, err := e.salt(); err == nil {
+		forgetDerivedKey(salt, e.Iterations)
+	}
+}
+
+// encrypt seals a value of the file
+func (e *Encryption) encrypt(ctx context.Context, value string) (string, error) {
+	key, err := e.key(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	defer key.Zero()
+	plaintext := []byte(value)
+	defer clear(plaintext)
+	sealed, err := secret.Encrypt(key, plaintext)
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a value sealed by encrypt
+func (e *Encryption) decrypt(ctx context.Context, value string) (*secret.Secret, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	key, err := e.key(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+	plaintext, err := secret.Decrypt(key, sealed)
+	if errors.Is(err, secret.ErrDecrypt) {
+		e.forgetKey()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secret.New(plaintext), nil
+}
+
+// IsEncrypted reports whether a configuration value is encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// decryptField returns the plaintext value of a field of the registry
+func (r Registry) decryptField(ctx context.Context, name string) (*secret.Secret, error) {
+	value := r.Field(name)
+	if !IsEncrypted(value) {
+		return secret.FromString(value), nil
+	}
+	if r.encryption == nil {
+		return nil, fmt.Errorf("registry '%s' has an encrypted %s but the config file has no encryption settings", r.Name, name)
+	}
+	plaintext, err := r.encryption.decrypt(ctx, value)
+	if err != nil {
+		return nil, fmt.Errorf("registry '%s': failed to decrypt the %s: %w", r.Name, name, err)
+	}
+	return plaintext, nil
+}
+
+// applyEncryption lets the registries decrypt their values with the settings of the file
+func (c *Config) applyEncryption() {
+	for key, registry := range c.Registries {
+		registry.encryption = c.Encryption
+		c.Registries[key] = registry
+	}
+}
+
+// sealSensitiveFields encrypts the sensitive fields still in plain text when the
+// configuration is encrypted. It runs before every write of the configuration
+// file, so values set by `edit` or `add` never reach the disk unencrypted.
+func (c *Config) sealSensitiveFields(ctx context.Context) (int, error) {
+	if c.Encryption == nil {
+		return 0, nil
+	}
+	sealed := 0
+	for key, registry := range c.Registries {
+		for _, name := range sensitiveFields {
+			value := registry.Field(name)
+			if value == "" || IsEncrypted(value) {
+				continue
+			}
+			encrypted, err := c.Encryption.encrypt(ctx, value)
+			if err != nil {
+				return sealed, fmt.Errorf("failed to encrypt the %s of registry '%s': %w", name, key, err)
+			}
+			registry.SetField(name, encrypted)
+			sealed++
+		}
+		c.Registries[key] = registry
+	}
+	return sealed, nil
+}
+
+// EncryptConfig turns on the encryption of the sensitive fields of the
+// configuration file, asking for a new passphrase, and returns the number of
+// values encrypted. An encrypted file only gets its remaining plain text values
+// encrypted. The migration backups of the file still hold the passwords in
+// plain text, so they are deleted once the file is encrypted and returned.
+func EncryptConfig(ctx context.Context, configPath string) (int, []string, error) {
+	var sealed int
+	err := UpdateConfig(ctx, configPath, func(config *Config) error {
+		if config.Encryption == nil {
+			encryption, err := NewEncryption()
+			if err != nil {
+				return err
+			}
+			key, err := encryption.key(ctx, true)
+			if err != nil {
+				return err
+			}
+			key.Zero()
+			config.Encryption = encryption
+		}
+		var err error
+		sealed, err = config.sealSensitiveFields(ctx)
+		return err
+	})
+	if err != nil {
+		return sealed, nil, err
+	}
+
+	backups, err := migrationBackups(configPath)
+	if err != nil {
+		return sealed, nil, err
+	}
+	for i, backup := range backups {
+		if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return sealed, backups[:i], fmt.Errorf("failed to remove the plain text backup %s: %w", backup, err)
+		}
+	}
+	return sealed, backups, nil
+}
+
+// DecryptConfig decrypts the sensitive fields of the configuration file and
+// turns its encryption off, returning the number of values decrypted. The values
+// go back to the file in plain text, so there is nothing left to zero.
+func DecryptConfig(ctx context.Context, configPath string) (int, error) {
+	var opened int
+	err := UpdateConfig(ctx, configPath, func(config *Config) error {
+		if config.Encryption == nil {
+			return fmt.Errorf("config file is not encrypted")
+		}
+		for key, registry := range config.Registries {
+			for _, name := range sensitiveFields {
+				if !IsEncrypted(registry.Field(name)) {
+					continue
+				}
+				plaintext, err := registry.decryptField(ctx, name)
+				if err != nil {
+					return err
+				}
+				registry.SetField(name, plaintext.Reveal())
+				opened++
+			}
+			registry.encryption = nil
+			config.Registries[key] = registry
+		}
+		config.Encryption = nil
+		return nil
+	})
+	return opened, err
+}
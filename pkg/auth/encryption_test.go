@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withPassphrase sets the passphrase of the encrypted files and forgets the
+// passphrase and keys cached by earlier tests
+func withPassphrase(t *testing.T, value string) {
+	t.Helper()
+	t.Setenv(PassphraseEnvVar, value)
+	forget := func() {
+		ForgetPassphrase()
+		derivedKeys.Lock()
+		derivedKeys.keys = nil
+		derivedKeys.Unlock()
+	}
+	forget()
+	t.Cleanup(forget)
+}
+
+func TestEncryptConfigRemovesPlainBackups(t *testing.T) {
+	configPath := testConfigPath(t)
+	writeTestFile(t, configPath, strings.Replace(baselineConfig, `password: ""`, "password: hunter2", 1))
+	withPassphrase(t, "correct horse")
+	if _, err := LoadConfig(configPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(migrationBackupPath(configPath, 1)); err != nil {
+		t.Fatalf("expected a migration backup: %v", err)
+	}
+
+	ctx := context.Background()
+	count, removed, err := EncryptConfig(ctx, configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || len(removed) != 1 || removed[0] != migrationBackupPath(configPath, 1) {
+		t.Errorf("got %d values encrypted and %v removed", count, removed)
+	}
+	if _, err := os.Stat(removed[0]); !os.IsNotExist(err) {
+		t.Errorf("the plain text backup is still there: %v", err)
+	}
+	if data, _ := os.ReadFile(configPath); strings.Contains(string(data), "hunter2") {
+		t.Errorf("the encrypted config holds the password:\n%s", data)
+	}
+
+	// The password is still there for the next login, and decrypting brings it back
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, err := registryPassword(ctx, config.Registries["hub"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password.Reveal() != "hunter2" {
+		t.Errorf("got password %q", password.Reveal())
+	}
+	if count, err := DecryptConfig(ctx, configPath); err != nil || count != 1 {
+		t.Fatalf("got %d values decrypted, %v", count, err)
+	}
+	if data, _ := os.ReadFile(configPath); !strings.Contains(string(data), "password: hunter2") {
+		t.Errorf("the decrypted config lost the password:\n%s", data)
+	}
+}
+
+// Writes of the state alone never need the passphrase, the configuration file
+// gets its plain text values sealed when it is written
+func TestSealOnlyWhenConfigChanges(t *testing.T) {
+	configPath := testConfigPath(t)
+	writeTestFile(t, configPath, "version: 2\nregistries:\n  hub:\n    name: hub\n    type: docker\n    url: registry.example.com\n    username: me\n    password: hunter2\n")
+	withPassphrase(t, "correct horse")
+	ctx := context.Background()
+	if _, _, err := EncryptConfig(ctx, configPath); err != nil {
+		t.Fatal(err)
+	}
+	// A password typed into the encrypted file by hand
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := string(data) + "  other:\n    name: other\n    type: docker\n    url: other.example.com\n    username: me\n    password: s3cret\n"
+	writeTestFile(t, configPath, edited)
+
+	withPassphrase(t, "")
+	err = UpdateConfig(ctx, configPath, func(config *Config) error {
+		hub := config.Registries["hub"]
+		hub.recordLogin(time.Now(), time.Time{})
+		config.Registries["hub"] = hub
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("recording a login needed the passphrase: %v", err)
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != edited {
+		t.Errorf("recording a login rewrote the config file:\n%s", data)
+	}
+
+	withPassphrase(t, "correct horse")
+	err = UpdateConfig(ctx, configPath, func(config *Config) error {
+		hub := config.Registries["hub"]
+		hub.Username = "you"
+		config.Registries["hub"] = hub
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(configPath); strings.Contains(string(data), "s3cret") {
+		t.Errorf("the edited config holds a password in plain text:\n%s", data)
+	}
+}
+
+func TestDecryptWithWrongPassphrase(t *testing.T) {
+	configPath := testConfigPath(t)
+	writeTestFile(t, configPath, "version: 2\nregistries:\n  hub:\n    name: hub\n    type: docker\n    url: registry.example.com\n    username: me\n    password: hunter2\n")
+	withPassphrase(t, "correct horse")
+	ctx := context.Background()
+	if _, _, err := EncryptConfig(ctx, configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	withPassphrase(t, "wrong")
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registryPassword(ctx, config.Registries["hub"]); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("got %v, want a wrong passphrase error", err)
+	}
+}
+
+// Concurrent logins keep their own copy of the key while another one forgets it
+func TestForgetKeyDuringConcurrentDecrypts(t *testing.T) {
+	configPath := testConfigPath(t)
+	writeTestFile(t, configPath, "version: 2\nregistries:\n  hub:\n    name: hub\n    type: docker\n    url: registry.example.com\n    username: me\n    password: hunter2\n")
+	withPassphrase(t, "correct horse")
+	ctx := context.Background()
+	if _, _, err := EncryptConfig(ctx, configPath); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := config.Registries["hub"]
+	key, err := registry.encryption.key(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Zero()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			registry.encryption.forgetKey()
+		}()
+		go func() {
+			defer wg.Done()
+			password, err := registry.decryptField(ctx, FieldPassword)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if password.Reveal() != "hunter2" {
+				t.Errorf("got password %q", password.Reveal())
+			}
+			password.Zero()
+		}()
+	}
+	wg.Wait()
+	if key.Empty() {
+		t.Error("forgetting the key zeroed a copy handed out earlier")
+	}
+}
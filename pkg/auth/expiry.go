@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// TimeFormat is the layout of every date stored in the configuration, in local time
+const TimeFormat = "2006-01-02 15:04:05"
+
+// DefaultExpiringSoon is how close to its expiry a login is reported as expiring soon
+const DefaultExpiringSoon = time.Hour
+
+// ExpiryStatus describes whether the credential of a registry is still usable
+type ExpiryStatus string
+
+// Expiry statuses reported by Registry.Status
+const (
+	StatusValid        ExpiryStatus = "valid"
+	StatusExpiringSoon ExpiryStatus = "expiring soon"
+	StatusExpired      ExpiryStatus = "expired"
+	StatusNoExpiry     ExpiryStatus = "no expiry"
+	StatusNeverLogged  ExpiryStatus = "not logged in"
+	StatusLoggedOut    ExpiryStatus = "logged out"
+)
+
+// parseTime parses a date stored in the configuration
+func parseTime(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(TimeFormat, value, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// formatTime formats a date to be stored in the configuration, zero dates become empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(TimeFormat)
+}
+
+// ExpiryTime returns when the current login of the registry expires. Registries
+// saved before `expires_at` existed fall back to the type's token lifetime.
+func (r Registry) ExpiryTime() (time.Time, bool) {
+	if expiresAt, ok := parseTime(r.ExpiresAt); ok {
+		return expiresAt, true
+	}
+	lastLogin, ok := parseTime(r.LastLogin)
+	if !ok {
+		return time.Time{}, false
+	}
+	if lifetime := r.tokenLifetime(); lifetime > 0 {
+		return lastLogin.Add(lifetime), true
+	}
+	return time.Time{}, false
+}
+
+// tokenLifetime is the configured TTL of the registry or, if unset, the lifetime of its type
+func (r Registry) tokenLifetime() time.Duration {
+	if ttl, err := time.ParseDuration(r.TTL); err == nil && ttl > 0 {
+		return ttl
+	}
+	if provider, err := GetProvider(r.Type); err == nil {
+		if aware, ok := provider.(RegistryAwareProvider); ok {
+			return aware.RegistryTokenLifetime(r)
+		}
+		return provider.TokenLifetime()
+	}
+	return 0
+}
+
+// Status reports the expiry status of the registry at the given time
+func (r Registry) Status(now time.Time, expiringSoon time.Duration) ExpiryStatus {
+	if r.LastLogin == "" {
+		return StatusNeverLogged
+	}
+	if r.LoggedOut() {
+		return StatusLoggedOut
+	}
+	expiresAt, ok := r.ExpiryTime()
+	switch {
+	case !ok:
+		return StatusNoExpiry
+	case !now.Before(expiresAt):
+		return StatusExpired
+	case expiresAt.Sub(now) <= expiringSoon:
+		return StatusExpiringSoon
+	default:
+		return StatusValid
+	}
+}
+
+// LoggedOut reports whether the registry was logged out of after its last login
+func (r Registry) LoggedOut() bool {
+	lastLogout, ok := parseTime(r.LastLogout)
+	if !ok {
+		return false
+	}
+	lastLogin, ok := parseTime(r.LastLogin)
+	return !ok || !lastLogout.Before(lastLogin)
+}
+
+// recordLogin updates the login date and expiry of the registry after a successful
+// login. Providers that could not tell when their token expires fall back to the
+// registry TTL. The last logout is forgotten: dates are stored to the second, so
+// a logout in the same second would otherwise hide the new login.
+func (r *Registry) recordLogin(now, expiresAt time.Time) {
+	if expiresAt.IsZero() {
+		if ttl, err := time.ParseDuration(r.TTL); err == nil && ttl > 0 {
+			expiresAt = now.Add(ttl)
+		}
+	}
+	r.LastLogin = formatTime(now)
+	r.ExpiresAt = formatTime(expiresAt)
+	r.LastLogout = ""
+}
+
+// RecordLogout updates the logout date of the registry and forgets its expiry
+func (r *Registry) RecordLogout(now time.Time) {
+	r.LastLogout = formatTime(now)
+	r.ExpiresAt = ""
+}
+
+// jwtExpiry returns the `exp` claim of a token when it is a JWT
+func jwtExpiry(token *secret.Secret) (time.Time, bool) {
+	parts := bytes.Split(token.Bytes(), []byte("."))
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(string(parts[1]), "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(claims.Exp), 0), true
+}
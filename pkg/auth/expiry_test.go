@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// testJWT returns an unsigned JWT with the given payload
+func testJWT(payload string) *secret.Secret {
+	encode := base64.RawURLEncoding.EncodeToString
+	return secret.FromString(encode([]byte(`{"alg":"none"}`)) + "." + encode([]byte(payload)) + ".signature")
+}
+
+func TestJWTExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  *secret.Secret
+		want   time.Time
+		wantOK bool
+	}{
+		{"exp claim", testJWT(`{"sub":"me","exp":1767225600}`), time.Unix(1767225600, 0), true},
+		{"padded payload", secret.FromString("e30." + base64.URLEncoding.EncodeToString([]byte(`{"exp":1767225600}`)) + ".sig"), time.Unix(1767225600, 0), true},
+		{"no exp claim", testJWT(`{"sub":"me"}`), time.Time{}, false},
+		{"negative exp", testJWT(`{"exp":-1}`), time.Time{}, false},
+		{"plain password", secret.FromString("hunter2"), time.Time{}, false},
+		{"dotted password", secret.FromString("a.b.c"), time.Time{}, false},
+		{"malformed payload", secret.FromString("e30.!!!.sig"), time.Time{}, false},
+		{"payload not JSON", testJWT(`not json`), time.Time{}, false},
+		{"empty", nil, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := jwtExpiry(tt.token)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("got %s, %v, want %s, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestExpiryTime(t *testing.T) {
+	login := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		registry Registry
+		want     time.Time
+		wantOK   bool
+	}{
+		{"expires_at", Registry{Type: "docker", LastLogin: formatTime(login), ExpiresAt: formatTime(login.Add(time.Hour))}, login.Add(time.Hour), true},
+		{"ttl fallback", Registry{Type: "docker", TTL: "8h", LastLogin: formatTime(login)}, login.Add(8 * time.Hour), true},
+		{"lifetime of the type", Registry{Type: "aws", LastLogin: formatTime(login)}, login.Add(ecrTokenLifetime), true},
+		{"lifetime of the settings", Registry{Type: "helm", Auth: helmAuthBasic, LastLogin: formatTime(login)}, time.Time{}, false},
+		{"invalid ttl", Registry{Type: "docker", TTL: "soon", LastLogin: formatTime(login)}, time.Time{}, false},
+		{"no expiry", Registry{Type: "docker", LastLogin: formatTime(login)}, time.Time{}, false},
+		{"never logged in", Registry{Type: "aws"}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.registry.ExpiryTime()
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("got %s, %v, want %s, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	expiring := func(in time.Duration) Registry {
+		return Registry{Type: "docker", LastLogin: formatTime(now.Add(-time.Hour)), ExpiresAt: formatTime(now.Add(in))}
+	}
+	loggedOut := expiring(time.Hour)
+	loggedOut.LastLogout = formatTime(now)
+	loginAfterLogout := expiring(2 * time.Hour)
+	loginAfterLogout.LastLogout = formatTime(now.Add(-2 * time.Hour))
+
+	tests := []struct {
+		name     string
+		registry Registry
+		want     ExpiryStatus
+	}{
+		{"valid", expiring(2 * time.Hour), StatusValid},
+		{"just beyond the expiring window", expiring(time.Hour + time.Second), StatusValid},
+		{"expiring at the window", expiring(time.Hour), StatusExpiringSoon},
+		{"expiring soon", expiring(time.Second), StatusExpiringSoon},
+		{"expired at the expiry", expiring(0), StatusExpired},
+		{"expired", expiring(-time.Second), StatusExpired},
+		{"no expiry", Registry{Type: "docker", LastLogin: formatTime(now)}, StatusNoExpiry},
+		{"never logged in", Registry{Type: "docker"}, StatusNeverLogged},
+		{"logged out", loggedOut, StatusLoggedOut},
+		{"logged in after the logout", loginAfterLogout, StatusValid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.registry.Status(now, DefaultExpiringSoon); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/user-cube/auth-refresher/pkg/keyring"
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// KeyringEnvVar names the environment variable choosing where remembered
+// passwords go: "secret-service", "file" (the encrypted secret store) or empty
+// to use the Secret Service when one is running and the secret store otherwise
+const KeyringEnvVar = "AUTH_REFRESHER_KEYRING"
+
+// Keyring backends
+const (
+	keyringSecretService = "secret-service"
+	keyringFile          = "file"
+)
+
+// keyringAttributes identify the keyring item of a registry
+func keyringAttributes(key string) map[string]string {
+	return map[string]string{"application": "auth-refresher", "registry": key}
+}
+
+func resolveKeyringSecret(ctx context.Context, key string) (*secret.Secret, error) {
+	value, err := keyring.NewSecretService().Get(ctx, keyringAttributes(key))
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("no password remembered for '%s' in the keyring, log in with --remember again", key)
+	}
+	return value, err
+}
+
+// keyringBackend returns the backend remembered passwords are stored in
+func keyringBackend(ctx context.Context) (string, error) {
+	switch backend := os.Getenv(KeyringEnvVar); backend {
+	case keyringSecretService, keyringFile:
+		return backend, nil
+	case "":
+		if keyring.NewSecretService().Available(ctx) {
+			return keyringSecretService, nil
+		}
+		return keyringFile, nil
+	default:
+		return "", fmt.Errorf("invalid %s '%s', expected %s or %s", KeyringEnvVar, backend, keyringSecretService, keyringFile)
+	}
+}
+
+// RememberPassword stores the password of the registry in the keyring, or in
+// the encrypted secret store when no keyring is available, and returns the
+// password_from source reading it back. The entries of the secret store are
+// plain strings while they are encrypted, which cannot be zeroed.
+func RememberPassword(ctx context.Context, key string, password *secret.Secret) (string, error) {
+	backend, err := keyringBackend(ctx)
+	if err != nil {
+		return "", err
+	}
+	if backend == keyringSecretService {
+		if err := keyring.NewSecretService().Set(ctx, "auth-refresher: "+key, keyringAttributes(key), password); err != nil {
+			return "", err
+		}
+		return "keyring:" + key, nil
+	}
+
+	err = UpdateSecretStore(ctx, func(entries map[string]string) error {
+		entries[key] = password.Reveal()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "store:" + key, nil
+}
+
+// canRemember reports whether the registry has a password, typed or configured,
+// that is not read from a source yet
+func canRemember(registry Registry) bool {
+	return registry.PasswordFrom == "" && !registry.password.Empty()
+}
+
+// rememberRegistryPassword remembers the password read by fillSecrets, see RememberPassword
+func rememberRegistryPassword(ctx context.Context, key string, registry Registry) (string, error) {
+	return RememberPassword(ctx, key, registry.password)
+}
+
+// ForgetPassword removes the password remembered for the registry and clears
+// its password_from. Secret store entries still referenced by other registries
+// are kept.
+func ForgetPassword(ctx context.Context, configPath string, key string) error {
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	registry, exists := config.Registries[key]
+	if !exists {
+		return fmt.Errorf("registry '%s' not found in the configuration", key)
+	}
+
+	source := registry.PasswordFrom
+	if source == "" {
+		// The password may have been remembered before password_from was cleared by hand
+		source = "keyring:" + key
+	}
+	scheme, ref, _ := strings.Cut(source, ":")
+	switch scheme {
+	case "keyring":
+		err := keyring.NewSecretService().Delete(ctx, keyringAttributes(ref))
+		if errors.Is(err, keyring.ErrNotFound) && registry.PasswordFrom == "" {
+			return fmt.Errorf("no password remembered for registry '%s'", key)
+		}
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return err
+		}
+	case "store":
+		if _, err := os.Stat(SecretStorePath()); err == nil && !sharedSecretSource(config, key, source) {
+			err := UpdateSecretStore(ctx, func(entries map[string]string) error {
+				delete(entries, ref)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("registry '%s' reads its password from %s, which is not remembered by auth-refresher", key, source)
+	}
+
+	return UpdateConfig(ctx, configPath, func(config *Config) error {
+		stored, exists := config.Registries[key]
+		if !exists {
+			return nil
+		}
+		stored.PasswordFrom = ""
+		config.Registries[key] = stored
+		return nil
+	})
+}
+
+// sharedSecretSource reports whether another registry than key reads its password from source
+func sharedSecretSource(config *Config, key, source string) bool {
+	for other, registry := range config.Registries {
+		if other != key && registry.PasswordFrom == source {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package auth
+
+// lockFile is a no-op where advisory file locks are not available; writes are
+// still atomic, only concurrent updates are not serialized
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CurrentConfigVersion is the version of the configuration schema written by this release
+const CurrentConfigVersion = 2
+
+// migration upgrades a configuration document from one version to the next. The
+// document is the raw YAML mapping, runtime state found in it goes to state.
+type migration struct {
+	from        int
+	description string
+	migrate     func(doc map[string]any, state *State) error
+}
+
+// migrations lists every upgrade step, in order. Files without a version key are version 1.
+var migrations = []migration{
+	{
+		from:        1,
+		description: "move last_used_registry and login dates to the state file",
+		migrate:     migrateStateOut,
+	},
+}
+
+// migrateDocument upgrades the document to CurrentConfigVersion and returns the version it started from
+func migrateDocument(doc map[string]any, state *State) (int, error) {
+	version := 1
+	if raw, ok := doc["version"]; ok {
+		v, ok := raw.(int)
+		if !ok || v < 1 {
+			return 0, fmt.Errorf("invalid config version: %v", raw)
+		}
+		version = v
+	}
+	if version > CurrentConfigVersion {
+		return 0, fmt.Errorf("config version %d is newer than supported version %d, please upgrade auth-refresher", version, CurrentConfigVersion)
+	}
+
+	from := version
+	for _, step := range migrations {
+		if step.from != version {
+			continue
+		}
+		if err := step.migrate(doc, state); err != nil {
+			return 0, fmt.Errorf("failed to migrate config from version %d (%s): %w", step.from, step.description, err)
+		}
+		version = step.from + 1
+	}
+	if version != CurrentConfigVersion {
+		return 0, fmt.Errorf("no migration path from config version %d", version)
+	}
+	doc["version"] = CurrentConfigVersion
+	return from, nil
+}
+
+// migrateStateOut moves the runtime fields of version 1 files to the state
+func migrateStateOut(doc map[string]any, state *State) error {
+	if current, ok := doc["last_used_registry"].(string); ok && state.CurrentRegistry == "" {
+		state.CurrentRegistry = current
+	}
+	delete(doc, "last_used_registry")
+
+	registries, ok := doc["registries"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	for key, raw := range registries {
+		registry, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		var registryState RegistryState
+		registryState.LastLogin, _ = registry["last_login"].(string)
+		registryState.LastLogout, _ = registry["last_logout"].(string)
+		registryState.ExpiresAt, _ = registry["expires_at"].(string)
+		delete(registry, "last_login")
+		delete(registry, "last_logout")
+		delete(registry, "expires_at")
+
+		// The state file wins, it may already hold newer dates
+		if _, exists := state.Registries[key]; exists || registryState == (RegistryState{}) {
+			continue
+		}
+		if state.Registries == nil {
+			state.Registries = make(map[string]RegistryState)
+		}
+		state.Registries[key] = registryState
+	}
+	return nil
+}
+
+// migrationBackupPath is the copy of a configuration file kept before migrating
+// it from the given version
+func migrationBackupPath(configPath string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", configPath, version)
+}
+
+// migrationBackups returns the migration backups kept next to the configuration file
+func migrationBackups(configPath string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(configPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the config backups: %w", err)
+	}
+	prefix := filepath.Base(configPath) + ".v"
+	var backups []string
+	for _, entry := range entries {
+		version, found := strings.CutPrefix(entry.Name(), prefix)
+		if version, found = strings.CutSuffix(version, ".bak"); !found {
+			continue
+		}
+		if _, err := strconv.Atoi(version); err == nil {
+			backups = append(backups, filepath.Join(filepath.Dir(configPath), entry.Name()))
+		}
+	}
+	return backups, nil
+}
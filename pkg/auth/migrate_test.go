@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// baselineConfig is a configuration written before the schema was versioned,
+// with the runtime state in it and every key present
+const baselineConfig = `last_used_registry: hub
+registries:
+  hub:
+    name: hub
+    type: docker
+    url: registry.example.com
+    region: ""
+    username: me
+    password: ""
+    last_login: "2024-01-02 03:04:05"
+    last_logout: ""
+  ecr:
+    name: ecr
+    type: aws
+    url: 123456789012.dkr.ecr.eu-west-1.amazonaws.com
+    region: eu-west-1
+    username: ""
+    password: ""
+    last_login: "2024-01-01 10:00:00"
+    last_logout: "2024-01-01 11:00:00"
+`
+
+func TestMigrateBaselineConfig(t *testing.T) {
+	configPath := testConfigPath(t)
+	writeTestFile(t, configPath, baselineConfig)
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Version != CurrentConfigVersion || config.CurrentRegistry != "hub" {
+		t.Errorf("got version %d and current registry %q", config.Version, config.CurrentRegistry)
+	}
+	hub, ecr := config.Registries["hub"], config.Registries["ecr"]
+	if hub.Username != "me" || hub.LastLogin != "2024-01-02 03:04:05" || ecr.LastLogout != "2024-01-01 11:00:00" {
+		t.Errorf("registries not migrated: %+v, %+v", hub, ecr)
+	}
+
+	backup, err := os.ReadFile(configPath + ".v1.bak")
+	if err != nil || string(backup) != baselineConfig {
+		t.Errorf("got backup %q, %v, want the original file", backup, err)
+	}
+	migrated, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"last_used_registry", "last_login", "last_logout"} {
+		if bytes.Contains(migrated, []byte(key)) {
+			t.Errorf("migrated config still holds %s:\n%s", key, migrated)
+		}
+	}
+	if !bytes.HasPrefix(migrated, []byte("version: 2\n")) {
+		t.Errorf("migrated config is not versioned:\n%s", migrated)
+	}
+	state, err := os.ReadFile(StatePath(configPath))
+	if err != nil || !strings.Contains(string(state), "last_used_registry: hub") || !strings.Contains(string(state), `last_login: "2024-01-02 03:04:05"`) {
+		t.Errorf("got state file %q, %v", state, err)
+	}
+
+	// Loading the migrated file again changes nothing, the backup included
+	writeTestFile(t, configPath+".v1.bak", "kept")
+	if _, err := LoadConfig(configPath); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(configPath); !bytes.Equal(again, migrated) {
+		t.Errorf("config changed on the second load:\n%s", again)
+	}
+	if backup, _ := os.ReadFile(configPath + ".v1.bak"); string(backup) != "kept" {
+		t.Errorf("backup overwritten: %q", backup)
+	}
+}
+
+func TestMigrateNewerConfig(t *testing.T) {
+	configPath := testConfigPath(t)
+	writeTestFile(t, configPath, "version: 99\nregistries: {}\n")
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "please upgrade auth-refresher") {
+		t.Errorf("got %v, want an upgrade error", err)
+	}
+}
+
+func TestLoginOnlyWritesState(t *testing.T) {
+	configPath := testConfigPath(t)
+	err := UpdateConfig(context.Background(), configPath, func(config *Config) error {
+		config.Registries["hub"] = Registry{Name: "hub", Type: "docker", URL: "registry.example.com", Username: "me"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	err = UpdateConfig(context.Background(), configPath, func(config *Config) error {
+		registry := config.Registries["hub"]
+		registry.recordLogin(now, now.Add(time.Hour))
+		config.Registries["hub"] = registry
+		config.CurrentRegistry = "hub"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file was neither rewritten nor replaced by a new one
+	after, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) || !after.ModTime().Equal(before.ModTime()) {
+		t.Error("a login rewrote the config file")
+	}
+	if again, _ := os.ReadFile(configPath); !bytes.Equal(again, contents) {
+		t.Errorf("a login changed the config file:\n%s", again)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hub := config.Registries["hub"]; hub.LastLogin != formatTime(now) || hub.ExpiresAt != formatTime(now.Add(time.Hour)) || config.CurrentRegistry != "hub" {
+		t.Errorf("login not recorded in the state: %+v, current %q", hub, config.CurrentRegistry)
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
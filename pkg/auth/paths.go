@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ConfigEnvVar names the environment variable pointing at the configuration file
+const ConfigEnvVar = "AUTH_REFRESHER_CONFIG"
+
+// ProjectConfigName is the file name of a project-local configuration, looked up
+// in the working directory and only used once trusted, see TrustConfig
+const ProjectConfigName = ".auth-refresher.yaml"
+
+// ConfigPath returns the configuration file to use. An explicit path (from the
+// --config flag) wins, then the AUTH_REFRESHER_CONFIG environment variable, then
+// the first existing file among a trusted .auth-refresher.yaml of the working
+// directory, the XDG configuration and the legacy ~/.auth-refresher/config.yaml.
+// When none exists the XDG location is returned so new configurations are
+// created there. A project-local file found this way is discovered rather than
+// named, so it may not run commands or read files, see Registry.checkDiscovered.
+func ConfigPath(explicit string) string {
+	if explicit != "" {
+		markDiscovered(explicit, false)
+		return explicit
+	}
+	if path := os.Getenv(ConfigEnvVar); path != "" {
+		markDiscovered(path, false)
+		return path
+	}
+
+	for _, path := range ConfigSearchPaths() {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		if path == ProjectConfigPath() {
+			if !IsTrustedConfig(path) {
+				continue
+			}
+			markDiscovered(path, true)
+		}
+		return path
+	}
+	return xdgConfigPath()
+}
+
+// ConfigSearchPaths returns the configuration files looked up when no path is
+// given explicitly, in order of precedence
+func ConfigSearchPaths() []string {
+	var paths []string
+	if path := ProjectConfigPath(); path != "" {
+		paths = append(paths, path)
+	}
+	return append(paths, xdgConfigPath(), legacyConfigPath())
+}
+
+// ProjectConfigPath is the project-local configuration of the working
+// directory. Parent directories are not searched, so a repository cloned
+// somewhere below the home directory cannot take over every command run in it.
+func ProjectConfigPath() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, ProjectConfigName)
+}
+
+// xdgConfigPath is the configuration file under $XDG_CONFIG_HOME, defaulting to ~/.config
+func xdgConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "auth-refresher", "config.yaml")
+}
+
+// legacyConfigPath is where auth-refresher kept its configuration before XDG support
+func legacyConfigPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".auth-refresher", "config.yaml")
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// Registry field names understood by providers
+const (
+	FieldURL      = "url"
+	FieldRegion   = "region"
+	FieldUsername = "username"
+	FieldPassword = "password"
+
+	FieldPasswordFrom = "password_from"
+
+	FieldAccountID       = "account_id"
+	FieldProfile         = "profile"
+	FieldRoleARN         = "role_arn"
+	FieldRoleSessionName = "role_session_name"
+	FieldExternalID      = "external_id"
+
+	FieldAuth         = "auth"
+	FieldMode         = "mode"
+	FieldRepoName     = "repo_name"
+	FieldTokenCommand = "token_command"
+
+	FieldTokenSource    = "token_source"
+	FieldKeyFile        = "key_file"
+	FieldServiceAccount = "service_account"
+)
+
+// Field describes a registry configuration field needed by a provider
+type Field struct {
+	Name     string   // One of the Field* constants
+	Label    string   // Label shown when prompting for the field
+	Required bool     // Whether a login is impossible without the field
+	Secret   bool     // Secret fields are never prompted for in `add`, only at login time
+	Options  []string // Accepted values, the first one being the default, empty for free input
+}
+
+// Provider implements everything specific to a registry type. Adding a new
+// registry type only requires registering a new provider.
+type Provider interface {
+	// Type is the value of the `type` field handled by the provider
+	Type() string
+	// Description is a short human readable summary of the registry type
+	Description() string
+	// Fields lists the configuration fields of the registry type, in prompt order
+	Fields() []Field
+	// Validate checks that the registry holds everything needed to log in
+	Validate(registry Registry) error
+	// Login authenticates against the registry and stores the credentials. It
+	// returns when the credentials expire, or a zero time when unknown.
+	Login(ctx context.Context, registry Registry) (time.Time, error)
+	// Logout removes the stored credentials of the registry
+	Logout(ctx context.Context, registry Registry) error
+	// Username is the username the credentials of the registry are stored with
+	Username(registry Registry) string
+	// TokenLifetime is how long a login usually stays valid, zero when it does not expire
+	TokenLifetime() time.Duration
+}
+
+// DockerCredentialProvider is implemented by providers able to mint a Docker
+// credential on demand, which is what the credential helper relies on
+type DockerCredentialProvider interface {
+	DockerCredential(ctx context.Context, registry Registry) (username string, password *secret.Secret, err error)
+}
+
+// ErrNoCredential is returned by DockerCredential when the registry has no
+// credential to hand out, e.g. a docker registry whose password is asked at login time
+var ErrNoCredential = errors.New("no credential configured")
+
+// RegistryAwareProvider is implemented by providers whose fields and token
+// lifetime depend on the settings of the registry, such as its authentication mode
+type RegistryAwareProvider interface {
+	// RegistryFields replaces Fields for the given registry
+	RegistryFields(registry Registry) []Field
+	// RegistryTokenLifetime replaces TokenLifetime for the given registry
+	RegistryTokenLifetime(registry Registry) time.Duration
+}
+
+// Tool is an external program a provider runs
+type Tool struct {
+	Name        string   // Binary looked up on PATH
+	VersionArgs []string // Arguments making the binary print its version
+	MinVersion  string   // Oldest usable version, empty when any version works
+}
+
+// ToolProvider is implemented by providers relying on external programs, so
+// `doctor` can check they are installed. The programs may depend on the settings
+// of the registry.
+type ToolProvider interface {
+	Tools(registry Registry) []Tool
+}
+
+var providers = map[string]Provider{}
+
+// RegisterProvider makes a provider available for its registry type
+func RegisterProvider(provider Provider) {
+	if _, exists := providers[provider.Type()]; exists {
+		panic(fmt.Sprintf("provider for registry type '%s' registered twice", provider.Type()))
+	}
+	providers[provider.Type()] = provider
+}
+
+// GetProvider returns the provider for the given registry type
+func GetProvider(registryType string) (Provider, error) {
+	if registryType == "" {
+		return nil, fmt.Errorf("registry type is empty")
+	}
+	provider, exists := providers[registryType]
+	if !exists {
+		return nil, fmt.Errorf("unsupported registry type: %s", registryType)
+	}
+	return provider, nil
+}
+
+// ProviderTypes returns the sorted list of supported registry types
+func ProviderTypes() []string {
+	types := make([]string, 0, len(providers))
+	for registryType := range providers {
+		types = append(types, registryType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// RegistryFields returns the fields the provider needs for the registry, in prompt order
+func RegistryFields(provider Provider, registry Registry) []Field {
+	if aware, ok := provider.(RegistryAwareProvider); ok {
+		return aware.RegistryFields(registry)
+	}
+	return provider.Fields()
+}
+
+// Field returns the value of the named registry field
+func (r Registry) Field(name string) string {
+	switch name {
+	case FieldURL:
+		return r.URL
+	case FieldRegion:
+		return r.Region
+	case FieldUsername:
+		return r.Username
+	case FieldPassword:
+		return r.Password
+	case FieldPasswordFrom:
+		return r.PasswordFrom
+	case FieldAccountID:
+		return r.AccountID
+	case FieldProfile:
+		return r.Profile
+	case FieldRoleARN:
+		return r.RoleARN
+	case FieldRoleSessionName:
+		return r.RoleSessionName
+	case FieldExternalID:
+		return r.ExternalID
+	case FieldAuth:
+		return r.Auth
+	case FieldMode:
+		return r.Mode
+	case FieldRepoName:
+		return r.RepoName
+	case FieldTokenCommand:
+		return r.TokenCommand
+	case FieldTokenSource:
+		return r.TokenSource
+	case FieldKeyFile:
+		return r.KeyFile
+	case FieldServiceAccount:
+		return r.ServiceAccount
+	}
+	return ""
+}
+
+// SetField sets the value of the named registry field
+func (r *Registry) SetField(name, value string) {
+	switch name {
+	case FieldURL:
+		r.URL = value
+	case FieldRegion:
+		r.Region = value
+	case FieldUsername:
+		r.Username = value
+	case FieldPassword:
+		r.Password = value
+	case FieldPasswordFrom:
+		r.PasswordFrom = value
+	case FieldAccountID:
+		r.AccountID = value
+	case FieldProfile:
+		r.Profile = value
+	case FieldRoleARN:
+		r.RoleARN = value
+	case FieldRoleSessionName:
+		r.RoleSessionName = value
+	case FieldExternalID:
+		r.ExternalID = value
+	case FieldAuth:
+		r.Auth = value
+	case FieldMode:
+		r.Mode = value
+	case FieldRepoName:
+		r.RepoName = value
+	case FieldTokenCommand:
+		r.TokenCommand = value
+	case FieldTokenSource:
+		r.TokenSource = value
+	case FieldKeyFile:
+		r.KeyFile = value
+	case FieldServiceAccount:
+		r.ServiceAccount = value
+	}
+}
+
+// validateFields checks that every required, non secret field of the provider is
+// set and that fields with options hold one of them
+func validateFields(provider Provider, registry Registry) error {
+	for _, field := range RegistryFields(provider, registry) {
+		value := registry.Field(field.Name)
+		if field.Required && !field.Secret && value == "" {
+			return fmt.Errorf("%s registry '%s' has no %s defined", provider.Type(), registry.Name, field.Name)
+		}
+		if field.Name == FieldPasswordFrom && value != "" {
+			if _, _, err := ParseSecretSource(value); err != nil {
+				return fmt.Errorf("%s registry '%s': %w", provider.Type(), registry.Name, err)
+			}
+		}
+		if value != "" && len(field.Options) > 0 && !slices.Contains(field.Options, value) {
+			return fmt.Errorf("%s registry '%s' has an invalid %s '%s', expected one of %s",
+				provider.Type(), registry.Name, field.Name, value, strings.Join(field.Options, ", "))
+		}
+	}
+	return nil
+}
+
+// Login logs into the registry using the provider of its type and returns when the login expires
+func Login(ctx context.Context, registry Registry) (time.Time, error) {
+	provider, err := GetProvider(registry.Type)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return provider.Login(ctx, registry)
+}
+
+// Logout logs out of the registry using the provider of its type
+func Logout(ctx context.Context, registry Registry) error {
+	provider, err := GetProvider(registry.Type)
+	if err != nil {
+		return err
+	}
+	return provider.Logout(ctx, registry)
+}
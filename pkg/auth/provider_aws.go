@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/aws"
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// ecrURLPattern matches ECR registry hosts and captures their account and region
+var ecrURLPattern = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// accountIDPattern matches AWS account IDs
+var accountIDPattern = regexp.MustCompile(`^\d{12}$`)
+
+// awsCLI is the AWS CLI, only used as a fallback for credential sources not
+// supported natively. get-login-password appeared in 1.17.10.
+var awsCLI = Tool{Name: "aws", VersionArgs: []string{"--version"}, MinVersion: "1.17.10"}
+
+// ecrTokenLifetime is how long ECR authorization tokens are valid
+const ecrTokenLifetime = 12 * time.Hour
+
+// ecrUsername is the username of every ECR authorization token
+const ecrUsername = "AWS"
+
+// ecrFields are the fields of the registry types authenticating with an ECR token
+var ecrFields = []Field{
+	{Name: FieldAccountID, Label: "AWS Account ID (optional)"},
+	{Name: FieldRegion, Label: "Registry Region", Required: true},
+	{Name: FieldURL, Label: "Registry URL (empty to derive it from the account ID and region)"},
+	{Name: FieldProfile, Label: "AWS Profile (optional)"},
+	{Name: FieldRoleARN, Label: "Role ARN to assume (optional)"},
+	{Name: FieldRoleSessionName, Label: "Role Session Name (optional)"},
+	{Name: FieldExternalID, Label: "Role External ID (optional)"},
+}
+
+// ParseECRURL extracts the account ID and region of an ECR registry URL
+func ParseECRURL(url string) (account, region string, ok bool) {
+	host := DockerServerKey(url)
+	match := ecrURLPattern.FindStringSubmatch(host)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// ECRURL returns the registry host of an AWS account in a region
+func ECRURL(account, region string) string {
+	host := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", account, region)
+	if strings.HasPrefix(region, "cn-") {
+		host += ".cn"
+	}
+	return host
+}
+
+// validateECR checks the AWS settings shared by the registry types using ECR tokens
+func validateECR(provider Provider, registry Registry) error {
+	if err := validateFields(provider, registry); err != nil {
+		return err
+	}
+	if registry.ServerURL() == "" {
+		return fmt.Errorf("%s registry '%s' has no url defined, set it or set account_id to derive it", provider.Type(), registry.Name)
+	}
+	if registry.AccountID != "" && !accountIDPattern.MatchString(registry.AccountID) {
+		return fmt.Errorf("%s registry '%s' has an invalid account_id '%s', expected 12 digits", provider.Type(), registry.Name, registry.AccountID)
+	}
+	if registry.RoleARN == "" && (registry.RoleSessionName != "" || registry.ExternalID != "") {
+		return fmt.Errorf("%s registry '%s' sets role_session_name or external_id without a role_arn", provider.Type(), registry.Name)
+	}
+	if registry.RoleARN != "" && !strings.HasPrefix(registry.RoleARN, "arn:") {
+		return fmt.Errorf("%s registry '%s' has an invalid role_arn '%s'", provider.Type(), registry.Name, registry.RoleARN)
+	}
+	return nil
+}
+
+// ecrToken mints an ECR token for the registry, using its profile and assuming
+// its role when configured. The ECR API is called directly; the AWS CLI is only
+// used for credential sources that are not supported natively (SSO,
+// credential_process, instance roles...), when it is installed.
+func ecrToken(ctx context.Context, registry Registry) (aws.AuthorizationToken, error) {
+	client := aws.NewClient()
+	creds, err := client.Credentials(ctx, registry.Profile, registry.Region)
+	if err == nil && registry.RoleARN != "" {
+		creds, err = client.AssumeRole(ctx, creds, registry.Region, aws.AssumeRoleInput{
+			RoleARN:     registry.RoleARN,
+			SessionName: registry.RoleSessionName,
+			ExternalID:  registry.ExternalID,
+		})
+	}
+	if err != nil {
+		if errors.Is(err, aws.ErrNoCredentials) || errors.Is(err, aws.ErrUnsupportedProfile) {
+			if _, lookErr := exec.LookPath(awsCLI.Name); lookErr == nil {
+				return ecrTokenFromCLI(ctx, registry)
+			}
+		}
+		return aws.AuthorizationToken{}, err
+	}
+	return client.GetAuthorizationToken(ctx, creds, registry.Region)
+}
+
+// ecrTokenFromCLI mints an ECR token with the AWS CLI. The CLI does not tell
+// when the token expires, so the usual 12 hours lifetime is assumed.
+func ecrTokenFromCLI(ctx context.Context, registry Registry) (aws.AuthorizationToken, error) {
+	env, err := awsEnvironment(ctx, registry)
+	if err != nil {
+		return aws.AuthorizationToken{}, err
+	}
+	args := []string{"ecr", "get-login-password", "--region", registry.Region}
+	if registry.Profile != "" && registry.RoleARN == "" {
+		args = append(args, "--profile", registry.Profile)
+	}
+	cmd := exec.CommandContext(ctx, awsCLI.Name, args...)
+	cmd.Env = env
+	output, err := cmd.Output()
+	if err != nil {
+		return aws.AuthorizationToken{}, fmt.Errorf("failed to get ECR login password: %w", commandError(err))
+	}
+	return aws.AuthorizationToken{
+		Username:  ecrUsername,
+		Password:  secret.New(bytes.TrimSpace(output)),
+		ExpiresAt: time.Now().Add(ecrTokenLifetime),
+	}, nil
+}
+
+// awsEnvironment returns the environment of the AWS CLI calls. When the registry
+// has a role to assume, it holds the temporary credentials of that role.
+func awsEnvironment(ctx context.Context, registry Registry) ([]string, error) {
+	env := os.Environ()
+	if registry.RoleARN == "" {
+		return env, nil
+	}
+
+	sessionName := registry.RoleSessionName
+	if sessionName == "" {
+		sessionName = aws.DefaultRoleSessionName
+	}
+	args := []string{"sts", "assume-role", "--role-arn", registry.RoleARN, "--role-session-name", sessionName,
+		"--region", registry.Region, "--output", "json"}
+	if registry.ExternalID != "" {
+		args = append(args, "--external-id", registry.ExternalID)
+	}
+	if registry.Profile != "" {
+		args = append(args, "--profile", registry.Profile)
+	}
+	output, err := exec.CommandContext(ctx, awsCLI.Name, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume role %s: %w", registry.RoleARN, commandError(err))
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+		}
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse the credentials of role %s: %w", registry.RoleARN, err)
+	}
+
+	// The role credentials replace whatever the environment points to
+	kept := env[:0:0]
+	for _, variable := range env {
+		name, _, _ := strings.Cut(variable, "=")
+		switch name {
+		case "AWS_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN":
+			continue
+		}
+		kept = append(kept, variable)
+	}
+	return append(kept,
+		"AWS_ACCESS_KEY_ID="+result.Credentials.AccessKeyId,
+		"AWS_SECRET_ACCESS_KEY="+result.Credentials.SecretAccessKey,
+		"AWS_SESSION_TOKEN="+result.Credentials.SessionToken,
+	), nil
+}
+
+// commandError adds the standard error output of a failed command to its error
+func commandError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
+
+// awsProvider stores an AWS ECR token as a Docker credential
+type awsProvider struct{}
+
+func init() {
+	RegisterProvider(awsProvider{})
+}
+
+func (awsProvider) Type() string {
+	return "aws"
+}
+
+func (awsProvider) Description() string {
+	return "AWS ECR container registry"
+}
+
+func (awsProvider) Fields() []Field {
+	return ecrFields
+}
+
+func (p awsProvider) Validate(registry Registry) error {
+	return validateECR(p, registry)
+}
+
+func (p awsProvider) Login(ctx context.Context, registry Registry) (time.Time, error) {
+	token, err := ecrToken(ctx, registry)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer token.Password.Zero()
+	if err := StoreDockerCredential(ctx, registry.ServerURL(), token.Username, token.Password); err != nil {
+		return time.Time{}, fmt.Errorf("failed to store Docker credential: %w", err)
+	}
+	return token.ExpiresAt, nil
+}
+
+// DockerCredential mints a fresh ECR token
+func (awsProvider) DockerCredential(ctx context.Context, registry Registry) (string, *secret.Secret, error) {
+	token, err := ecrToken(ctx, registry)
+	if err != nil {
+		return "", nil, err
+	}
+	return token.Username, token.Password, nil
+}
+
+func (awsProvider) Logout(ctx context.Context, registry Registry) error {
+	if err := EraseDockerCredential(ctx, registry.ServerURL()); err != nil {
+		return fmt.Errorf("failed to remove Docker credential: %w", err)
+	}
+	return nil
+}
+
+// ECR tokens always come with the same username
+func (awsProvider) Username(Registry) string {
+	return ecrUsername
+}
+
+// ECR authorization tokens are valid for 12 hours
+func (awsProvider) TokenLifetime() time.Duration {
+	return ecrTokenLifetime
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// dockerProvider logs into a plain Docker registry with a username and password
+type dockerProvider struct{}
+
+func init() {
+	RegisterProvider(dockerProvider{})
+}
+
+func (dockerProvider) Type() string {
+	return "docker"
+}
+
+func (dockerProvider) Description() string {
+	return "Docker registry with username and password"
+}
+
+func (dockerProvider) Fields() []Field {
+	return []Field{
+		{Name: FieldURL, Label: "Registry URL", Required: true},
+		{Name: FieldUsername, Label: "Registry Username", Required: true},
+		passwordFromField,
+		{Name: FieldPassword, Label: "Enter your Docker password", Required: true, Secret: true},
+	}
+}
+
+func (p dockerProvider) Validate(registry Registry) error {
+	return validateFields(p, registry)
+}
+
+func (dockerProvider) Login(ctx context.Context, registry Registry) (time.Time, error) {
+	password, err := registryPassword(ctx, registry)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer password.Zero()
+	if err := StoreDockerCredential(ctx, registry.ServerURL(), registry.Username, password); err != nil {
+		return time.Time{}, fmt.Errorf("failed to store Docker credential: %w", err)
+	}
+	// Access tokens used as passwords are often JWTs carrying their own expiry
+	if expiresAt, ok := jwtExpiry(password); ok {
+		return expiresAt, nil
+	}
+	return time.Time{}, nil
+}
+
+// DockerCredential returns the configured username and password, reading the
+// password from its source when needed
+func (dockerProvider) DockerCredential(ctx context.Context, registry Registry) (string, *secret.Secret, error) {
+	if !registry.hasSecret(FieldPassword) {
+		return "", nil, fmt.Errorf("registry '%s': %w", registry.Name, ErrNoCredential)
+	}
+	password, err := registryPassword(ctx, registry)
+	if err != nil {
+		return "", nil, err
+	}
+	return registry.Username, password, nil
+}
+
+func (dockerProvider) Logout(ctx context.Context, registry Registry) error {
+	if err := EraseDockerCredential(ctx, registry.ServerURL()); err != nil {
+		return fmt.Errorf("failed to remove Docker credential: %w", err)
+	}
+	return nil
+}
+
+func (dockerProvider) Username(registry Registry) string {
+	return registry.Username
+}
+
+// Docker registry logins do not expire on their own, unless a `ttl` is configured
+func (dockerProvider) TokenLifetime() time.Duration {
+	return 0
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/gcp"
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// Token sources of Google Cloud registries
+const (
+	gcpSourceGcloud   = "gcloud"   // `gcloud auth print-access-token`
+	gcpSourceKey      = "key"      // Service account JSON key exchanged for a token
+	gcpSourceMetadata = "metadata" // Metadata server of Google Cloud machines
+)
+
+// gcpUsername is the username Google registries expect along with an access token
+const gcpUsername = "oauth2accesstoken"
+
+// gcpTokenLifetime is how long Google access tokens are usually valid
+const gcpTokenLifetime = time.Hour
+
+// gcpURLPattern matches Artifact Registry and Container Registry hosts
+var gcpURLPattern = regexp.MustCompile(`^(?:(?:[a-z]+\.)?gcr\.io|[a-z0-9-]+-docker\.pkg\.dev)$`)
+
+// gcpProvider stores a Google Cloud access token as a Docker credential
+type gcpProvider struct{}
+
+func init() {
+	RegisterProvider(gcpProvider{})
+}
+
+func (gcpProvider) Type() string {
+	return "gcp"
+}
+
+func (gcpProvider) Description() string {
+	return "Google Artifact Registry or Container Registry"
+}
+
+// Fields lists the fields of registries using gcloud, the default
+func (p gcpProvider) Fields() []Field {
+	return p.RegistryFields(Registry{})
+}
+
+// RegistryFields depends on the token source of the registry
+func (gcpProvider) RegistryFields(registry Registry) []Field {
+	fields := []Field{
+		{Name: FieldURL, Label: "Registry URL (e.g. europe-west1-docker.pkg.dev or gcr.io)", Required: true},
+		{Name: FieldTokenSource, Label: "Token Source", Options: []string{gcpSourceGcloud, gcpSourceKey, gcpSourceMetadata}},
+	}
+	if gcpTokenSource(registry) == gcpSourceKey {
+		return append(fields, Field{Name: FieldKeyFile, Label: "Service Account Key File (empty for GOOGLE_APPLICATION_CREDENTIALS)"})
+	}
+	return append(fields, Field{Name: FieldServiceAccount, Label: "Account (empty for the active or default one)"})
+}
+
+// gcpTokenSource returns the token source of the registry, gcloud by default
+func gcpTokenSource(registry Registry) string {
+	if registry.TokenSource == "" {
+		return gcpSourceGcloud
+	}
+	return registry.TokenSource
+}
+
+// gcpKeyFile returns the path of the service account key of the registry
+func gcpKeyFile(registry Registry) string {
+	path := registry.KeyFile
+	if path == "" {
+		path = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		path = filepath.Join(os.Getenv("HOME"), rest)
+	}
+	return path
+}
+
+func (p gcpProvider) Validate(registry Registry) error {
+	if err := validateFields(p, registry); err != nil {
+		return err
+	}
+	if host := DockerServerKey(registry.URL); !gcpURLPattern.MatchString(host) {
+		return fmt.Errorf("gcp registry '%s' has an invalid url '%s', expected an Artifact Registry (*-docker.pkg.dev) or Container Registry (gcr.io) host",
+			registry.Name, registry.URL)
+	}
+	if gcpTokenSource(registry) == gcpSourceKey && gcpKeyFile(registry) == "" {
+		return fmt.Errorf("gcp registry '%s' has no key_file defined and GOOGLE_APPLICATION_CREDENTIALS is not set", registry.Name)
+	}
+	return nil
+}
+
+// gcpToken mints an access token from the source of the registry
+func gcpToken(ctx context.Context, registry Registry) (gcp.Token, error) {
+	client := gcp.NewClient()
+	switch gcpTokenSource(registry) {
+	case gcpSourceKey:
+		if registry.KeyFile != "" {
+			if err := registry.checkDiscovered(FieldKeyFile); err != nil {
+				return gcp.Token{}, err
+			}
+		}
+		key, err := gcp.ReadServiceAccountKey(gcpKeyFile(registry))
+		if err != nil {
+			return gcp.Token{}, err
+		}
+		return client.ServiceAccountToken(ctx, key)
+	case gcpSourceMetadata:
+		return client.MetadataToken(ctx, registry.ServiceAccount)
+	default:
+		return gcpTokenFromCLI(ctx, client, registry)
+	}
+}
+
+// gcpTokenFromCLI gets the access token of gcloud, which does not tell when
+// the token expires, so the token info endpoint is asked. When it cannot be
+// reached the expiry is left unknown and the usual one hour lifetime is assumed.
+func gcpTokenFromCLI(ctx context.Context, client *gcp.Client, registry Registry) (gcp.Token, error) {
+	args := []string{"auth", "print-access-token"}
+	if registry.ServiceAccount != "" {
+		args = append(args, registry.ServiceAccount)
+	}
+	output, err := exec.CommandContext(ctx, "gcloud", args...).Output()
+	if err != nil {
+		return gcp.Token{}, fmt.Errorf("failed to get a gcloud access token: %w", commandError(err))
+	}
+	token := gcp.Token{AccessToken: secret.New(bytes.TrimSpace(output))}
+	if token.AccessToken.Empty() {
+		return gcp.Token{}, fmt.Errorf("gcloud printed no access token")
+	}
+	token.ExpiresAt, _ = client.TokenExpiry(ctx, token.AccessToken)
+	return token, nil
+}
+
+// Only the gcloud token source, the default, runs gcloud. Any version prints access tokens.
+func (gcpProvider) Tools(registry Registry) []Tool {
+	if gcpTokenSource(registry) != gcpSourceGcloud {
+		return nil
+	}
+	return []Tool{{Name: "gcloud", VersionArgs: []string{"version"}}}
+}
+
+func (p gcpProvider) Login(ctx context.Context, registry Registry) (time.Time, error) {
+	token, err := gcpToken(ctx, registry)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer token.AccessToken.Zero()
+	if err := StoreDockerCredential(ctx, registry.ServerURL(), gcpUsername, token.AccessToken); err != nil {
+		return time.Time{}, fmt.Errorf("failed to store Docker credential: %w", err)
+	}
+	return token.ExpiresAt, nil
+}
+
+// DockerCredential mints a fresh access token
+func (gcpProvider) DockerCredential(ctx context.Context, registry Registry) (string, *secret.Secret, error) {
+	token, err := gcpToken(ctx, registry)
+	if err != nil {
+		return "", nil, err
+	}
+	return gcpUsername, token.AccessToken, nil
+}
+
+func (gcpProvider) Logout(ctx context.Context, registry Registry) error {
+	if err := EraseDockerCredential(ctx, registry.ServerURL()); err != nil {
+		return fmt.Errorf("failed to remove Docker credential: %w", err)
+	}
+	return nil
+}
+
+// Access tokens are always paired with the same username
+func (gcpProvider) Username(Registry) string {
+	return gcpUsername
+}
+
+// Google access tokens are valid for an hour
+func (gcpProvider) TokenLifetime() time.Duration {
+	return gcpTokenLifetime
+}
+
+// Every token source mints tokens valid for an hour
+func (p gcpProvider) RegistryTokenLifetime(Registry) time.Duration {
+	return p.TokenLifetime()
+}
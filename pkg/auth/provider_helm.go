@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// Authentication modes of Helm registries
+const (
+	helmAuthECR   = "ecr"   // ECR token minted with the AWS settings of the registry
+	helmAuthBasic = "basic" // Username and password, asked at login time when not configured
+	helmAuthToken = "token" // Username and a password printed by token_command
+)
+
+// Helm registry modes
+const (
+	helmModeOCI  = "oci"  // OCI registry, `helm registry login`
+	helmModeRepo = "repo" // Classic chart repository, `helm repo add`
+)
+
+// helmProvider logs Helm into OCI registries or classic chart repositories
+type helmProvider struct{}
+
+func init() {
+	RegisterProvider(helmProvider{})
+}
+
+func (helmProvider) Type() string {
+	return "helm"
+}
+
+func (helmProvider) Description() string {
+	return "Helm OCI registry or chart repository (ECR, username/password or token)"
+}
+
+// Fields lists the fields of ECR hosted OCI registries, the default
+func (p helmProvider) Fields() []Field {
+	return p.RegistryFields(Registry{})
+}
+
+// RegistryFields depends on the authentication and the mode of the registry
+func (helmProvider) RegistryFields(registry Registry) []Field {
+	fields := []Field{
+		{Name: FieldAuth, Label: "Authentication", Options: []string{helmAuthECR, helmAuthBasic, helmAuthToken}},
+		{Name: FieldMode, Label: "Registry Mode", Options: []string{helmModeOCI, helmModeRepo}},
+	}
+	if helmAuth(registry) == helmAuthECR {
+		return append(fields, ecrFields...)
+	}
+
+	fields = append(fields, Field{Name: FieldURL, Label: "Registry URL", Required: true})
+	if helmMode(registry) == helmModeRepo {
+		fields = append(fields, Field{Name: FieldRepoName, Label: "Repository Name (empty for the registry name)"})
+	}
+	fields = append(fields, Field{Name: FieldUsername, Label: "Registry Username", Required: true})
+	if helmAuth(registry) == helmAuthToken {
+		return append(fields, Field{Name: FieldTokenCommand, Label: "Command printing the token", Required: true})
+	}
+	return append(fields, passwordFromField,
+		Field{Name: FieldPassword, Label: "Enter your Helm registry password", Required: true, Secret: true})
+}
+
+// helmAuth returns the authentication of the registry, ECR for registries
+// configured before other authentications existed
+func helmAuth(registry Registry) string {
+	if registry.Auth == "" {
+		return helmAuthECR
+	}
+	return registry.Auth
+}
+
+// helmMode returns the mode of the registry, OCI by default
+func helmMode(registry Registry) string {
+	if registry.Mode == "" {
+		return helmModeOCI
+	}
+	return registry.Mode
+}
+
+// helmRepoName is the name of the classic chart repository of the registry
+func helmRepoName(registry Registry) string {
+	if registry.RepoName != "" {
+		return registry.RepoName
+	}
+	return registry.Name
+}
+
+func (p helmProvider) Validate(registry Registry) error {
+	if helmAuth(registry) == helmAuthECR {
+		if err := validateECR(p, registry); err != nil {
+			return err
+		}
+	} else if err := validateFields(p, registry); err != nil {
+		return err
+	}
+
+	if helmMode(registry) == helmModeRepo {
+		if helmAuth(registry) == helmAuthECR {
+			return fmt.Errorf("helm registry '%s': ECR only hosts OCI registries, use mode oci", registry.Name)
+		}
+		if !strings.HasPrefix(registry.URL, "https://") && !strings.HasPrefix(registry.URL, "http://") {
+			return fmt.Errorf("helm registry '%s': chart repository URL must start with http:// or https://", registry.Name)
+		}
+	}
+	return nil
+}
+
+func (p helmProvider) Login(ctx context.Context, registry Registry) (time.Time, error) {
+	var username string
+	var password *secret.Secret
+	var expiresAt time.Time
+	switch helmAuth(registry) {
+	case helmAuthECR:
+		token, err := ecrToken(ctx, registry)
+		if err != nil {
+			return time.Time{}, err
+		}
+		username, password, expiresAt = token.Username, token.Password, token.ExpiresAt
+	case helmAuthToken:
+		// The token command is a password source of its own
+		var err error
+		if password, err = registry.resolveSecret(ctx, FieldTokenCommand, "cmd:"+registry.TokenCommand); err != nil {
+			return time.Time{}, err
+		}
+		username = registry.Username
+	default:
+		var err error
+		if password, err = registryPassword(ctx, registry); err != nil {
+			return time.Time{}, err
+		}
+		username = registry.Username
+	}
+	defer password.Zero()
+	if expiresAt.IsZero() {
+		// Access tokens are often JWTs carrying their own expiry
+		expiresAt, _ = jwtExpiry(password)
+	}
+
+	// The password is fed on stdin so it never shows up in the process list
+	var loginCmd *exec.Cmd
+	if helmMode(registry) == helmModeRepo {
+		loginCmd = exec.CommandContext(ctx, "helm", "repo", "add", helmRepoName(registry), registry.URL,
+			"--username", username, "--password-stdin", "--force-update")
+	} else {
+		loginCmd = exec.CommandContext(ctx, "helm", "registry", "login", helmRegistryHost(registry),
+			"--username", username, "--password-stdin")
+	}
+	loginCmd.Stdin = password.Reader()
+	if output, err := loginCmd.CombinedOutput(); err != nil {
+		return time.Time{}, fmt.Errorf("failed to perform Helm login: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return expiresAt, nil
+}
+
+// helmRegistryHost is the host `helm registry login` expects, without the oci:// scheme
+func helmRegistryHost(registry Registry) string {
+	return strings.TrimRight(strings.TrimPrefix(registry.ServerURL(), "oci://"), "/")
+}
+
+// Helm supports OCI registries out of the box since 3.8.0
+func (helmProvider) Tools(Registry) []Tool {
+	return []Tool{{Name: "helm", VersionArgs: []string{"version", "--short"}, MinVersion: "3.8.0"}}
+}
+
+func (helmProvider) Logout(ctx context.Context, registry Registry) error {
+	var logoutCmd *exec.Cmd
+	if helmMode(registry) == helmModeRepo {
+		logoutCmd = exec.CommandContext(ctx, "helm", "repo", "remove", helmRepoName(registry))
+	} else {
+		logoutCmd = exec.CommandContext(ctx, "helm", "registry", "logout", helmRegistryHost(registry))
+	}
+	if output, err := logoutCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to perform Helm logout: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// ECR tokens come with their own username, other logins use the configured one
+func (helmProvider) Username(registry Registry) string {
+	if helmAuth(registry) == helmAuthECR {
+		return ecrUsername
+	}
+	return registry.Username
+}
+
+// The ECR token used by Helm is valid for 12 hours
+func (helmProvider) TokenLifetime() time.Duration {
+	return ecrTokenLifetime
+}
+
+// Only ECR tokens expire on their own, other logins rely on the password or the ttl
+func (p helmProvider) RegistryTokenLifetime(registry Registry) time.Duration {
+	if helmAuth(registry) == helmAuthECR {
+		return p.TokenLifetime()
+	}
+	return 0
+}
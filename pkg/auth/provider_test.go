@@ -0,0 +1,25 @@
+package auth
+
+import "testing"
+
+func TestProviderUsername(t *testing.T) {
+	tests := []struct {
+		registry Registry
+		want     string
+	}{
+		{Registry{Type: "aws", Username: "ignored"}, ecrUsername},
+		{Registry{Type: "gcp", TokenSource: gcpSourceKey}, gcpUsername},
+		{Registry{Type: "docker", Username: "me"}, "me"},
+		{Registry{Type: "helm", Username: "ignored"}, ecrUsername},
+		{Registry{Type: "helm", Auth: helmAuthBasic, Username: "me"}, "me"},
+	}
+	for _, tt := range tests {
+		provider, err := GetProvider(tt.registry.Type)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := provider.Username(tt.registry); got != tt.want {
+			t.Errorf("%s registry %+v: got username %q, want %q", tt.registry.Type, tt.registry, got, tt.want)
+		}
+	}
+}
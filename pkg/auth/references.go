@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"sort"
+	"strings"
+)
+
+// referenceHost returns the registry host of an image or chart reference such as
+// 123456789012.dkr.ecr.us-west-2.amazonaws.com/app:1.0 or oci://registry.example.com/charts/app.
+// Only references with an explicit registry host are recognized, so plain words
+// and Docker Hub short names are ignored.
+func referenceHost(arg string) (host string, oci bool) {
+	ref := arg
+	if strings.HasPrefix(ref, "oci://") {
+		ref, oci = strings.TrimPrefix(ref, "oci://"), true
+	} else if strings.Contains(ref, "://") || strings.HasPrefix(ref, "-") {
+		return "", false
+	}
+	slash := strings.Index(ref, "/")
+	if slash <= 0 {
+		return "", false
+	}
+	host = ref[:slash]
+	if host == "." || host == ".." { // Relative paths, like a build context
+		return "", false
+	}
+	if host != "localhost" && !strings.ContainsAny(host, ".:") {
+		return "", false
+	}
+	return host, oci
+}
+
+// RegistriesForArgs returns the sorted keys of the registries referenced by the
+// image or chart references found in args. Plain references match registries
+// able to provide Docker credentials, oci:// references match any registry.
+func (c *Config) RegistriesForArgs(args []string) []string {
+	found := map[string]bool{}
+	for _, arg := range args {
+		// Flags like --tag=registry/image:1.0 carry the reference after the equal sign
+		if i := strings.Index(arg, "="); i >= 0 && strings.HasPrefix(arg, "-") {
+			arg = arg[i+1:]
+		}
+		host, oci := referenceHost(arg)
+		if host == "" {
+			continue
+		}
+		server := DockerServerKey(host)
+		for key, registry := range c.Registries {
+			if DockerServerKey(registry.ServerURL()) != server {
+				continue
+			}
+			if !oci {
+				provider, err := GetProvider(registry.Type)
+				if err != nil {
+					continue
+				}
+				if _, ok := provider.(DockerCredentialProvider); !ok {
+					continue
+				}
+			}
+			found[key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
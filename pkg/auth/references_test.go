@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestReferenceHost(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    string
+		wantOCI bool
+	}{
+		{"123456789012.dkr.ecr.us-west-2.amazonaws.com/app:1.0", "123456789012.dkr.ecr.us-west-2.amazonaws.com", false},
+		{"registry.example.com/team/app", "registry.example.com", false},
+		{"registry.example.com:5000/app:1.0", "registry.example.com:5000", false},
+		{"localhost:5000/app", "localhost:5000", false},
+		{"localhost/app", "localhost", false},
+		{"registry.example.com/app@sha256:0123456789abcdef", "registry.example.com", false},
+		{"registry.example.com/app:1.0@sha256:0123456789abcdef", "registry.example.com", false},
+		{"docker.io/library/nginx", "docker.io", false},
+		{"oci://registry.example.com/charts/app", "registry.example.com", true},
+		{"oci://localhost:5000/charts/app", "localhost:5000", true},
+		// Docker Hub short names and plain words name no registry
+		{"nginx", "", false},
+		{"nginx:1.27", "", false},
+		{"library/nginx", "", false},
+		{"user/app@sha256:0123456789abcdef", "", false},
+		{"pull", "", false},
+		{"./Dockerfile", "", false},
+		{"../context", "", false},
+		{"/tmp/context", "", false},
+		{"https://registry.example.com/app", "", false},
+		{"--tag", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			host, oci := referenceHost(tt.arg)
+			if host != tt.want || oci != tt.wantOCI {
+				t.Errorf("got %q, oci %v, want %q, oci %v", host, oci, tt.want, tt.wantOCI)
+			}
+		})
+	}
+}
+
+func TestRegistriesForArgs(t *testing.T) {
+	config := &Config{Registries: map[string]Registry{
+		"ecr":    {Type: "aws", URL: "123456789012.dkr.ecr.us-west-2.amazonaws.com"},
+		"hub":    {Type: "docker", URL: "https://index.docker.io/v1/"},
+		"local":  {Type: "docker", URL: "localhost:5000"},
+		"gar":    {Type: "gcp", URL: "https://europe-west1-docker.pkg.dev"},
+		"charts": {Type: "helm", Auth: helmAuthBasic, URL: "oci://charts.example.com"},
+	}}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"image", []string{"pull", "123456789012.dkr.ecr.us-west-2.amazonaws.com/app:1.0"}, []string{"ecr"}},
+		{"digest", []string{"pull", "123456789012.dkr.ecr.us-west-2.amazonaws.com/app@sha256:0123456789abcdef"}, []string{"ecr"}},
+		{"docker.io", []string{"pull", "docker.io/library/nginx"}, []string{"hub"}},
+		{"index.docker.io", []string{"pull", "index.docker.io/library/nginx:1.27"}, []string{"hub"}},
+		{"registry-1.docker.io", []string{"pull", "registry-1.docker.io/library/nginx"}, []string{"hub"}},
+		{"short name", []string{"pull", "nginx:1.27"}, []string{}},
+		{"port", []string{"push", "localhost:5000/app"}, []string{"local"}},
+		{"other port", []string{"push", "localhost:5001/app"}, []string{}},
+		{"flag value", []string{"build", "--tag=europe-west1-docker.pkg.dev/project/repo/app:1.0", "."}, []string{"gar"}},
+		{"several", []string{"localhost:5000/a", "europe-west1-docker.pkg.dev/p/r/b", "localhost:5000/c"}, []string{"gar", "local"}},
+		// Helm registries only log Helm in, so only oci:// references need them
+		{"oci chart", []string{"pull", "oci://charts.example.com/app"}, []string{"charts"}},
+		{"image of a helm registry", []string{"pull", "charts.example.com/app"}, []string{}},
+		{"unknown registry", []string{"pull", "quay.io/app"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.RegistriesForArgs(tt.args); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
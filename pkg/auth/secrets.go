@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// SecretResolver reads a secret from the reference following its scheme, e.g.
+// the variable name of "env:REGISTRY_PASSWORD"
+type SecretResolver func(ctx context.Context, ref string) (*secret.Secret, error)
+
+// passwordFromField is the optional source of the password of the registry types
+// authenticating with a username and password
+var passwordFromField = Field{Name: FieldPasswordFrom, Label: "Password Source (env:VAR, file:path, cmd:command, store:name or keyring:name, empty to be asked)"}
+
+// secretResolvers maps the schemes of secret sources to their resolver
+var secretResolvers = map[string]SecretResolver{
+	"env":     resolveEnvSecret,
+	"file":    resolveFileSecret,
+	"cmd":     resolveCommandSecret,
+	"store":   resolveStoredSecret,
+	"keyring": resolveKeyringSecret,
+}
+
+// SecretSchemes returns the sorted schemes accepted by ResolveSecret
+func SecretSchemes() []string {
+	schemes := make([]string, 0, len(secretResolvers))
+	for scheme := range secretResolvers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// ParseSecretSource splits a secret source such as "file:~/.registry-password"
+// into its scheme and reference
+func ParseSecretSource(source string) (string, string, error) {
+	scheme, ref, found := strings.Cut(source, ":")
+	if !found || ref == "" {
+		return "", "", fmt.Errorf("invalid secret source '%s', expected <scheme>:<reference> with scheme one of %s",
+			source, strings.Join(SecretSchemes(), ", "))
+	}
+	if _, exists := secretResolvers[scheme]; !exists {
+		return "", "", fmt.Errorf("unknown secret source scheme '%s', expected one of %s", scheme, strings.Join(SecretSchemes(), ", "))
+	}
+	return scheme, ref, nil
+}
+
+// ResolveSecret reads the secret a source points to:
+//
+//	env:VAR         the value of an environment variable
+//	file:path       the contents of a file, ~ being the home directory
+//	cmd:command     the output of a shell command, e.g. `pass show registry`
+//	store:name      an entry of the encrypted secret store, see SecretStorePath
+//	keyring:name    the password remembered for a registry in the keyring
+//
+// Trailing newlines are dropped from files and command outputs. An empty
+// secret is an error.
+func ResolveSecret(ctx context.Context, source string) (*secret.Secret, error) {
+	scheme, ref, err := ParseSecretSource(source)
+	if err != nil {
+		return nil, err
+	}
+	value, err := secretResolvers[scheme](ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if value.Empty() {
+		return nil, fmt.Errorf("secret source '%s' is empty", source)
+	}
+	return value, nil
+}
+
+func resolveEnvSecret(_ context.Context, name string) (*secret.Secret, error) {
+	value, found := os.LookupEnv(name)
+	if !found {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	return secret.FromString(value), nil
+}
+
+func resolveFileSecret(_ context.Context, path string) (*secret.Secret, error) {
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		path = filepath.Join(os.Getenv("HOME"), rest)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return secret.New(trimNewlines(data)), nil
+}
+
+func resolveCommandSecret(ctx context.Context, command string) (*secret.Secret, error) {
+	output, err := exec.CommandContext(ctx, "sh", "-c", command).Output()
+	if err != nil {
+		clear(output)
+		return nil, fmt.Errorf("failed to run the secret command: %w", commandError(err))
+	}
+	return secret.New(trimNewlines(output)), nil
+}
+
+// trimNewlines drops the line endings most tools print after a secret, keeping
+// any other whitespace which may be part of it
+func trimNewlines(data []byte) []byte {
+	return bytes.TrimRight(data, "\r\n")
+}
+
+// registryPassword returns the password of the registry: a copy of the one read
+// by fillSecrets, the configured one decrypted when the config file is
+// encrypted, or the one read from its password_from source when none is set
+func registryPassword(ctx context.Context, registry Registry) (*secret.Secret, error) {
+	if registry.password != nil {
+		return registry.password.Clone(), nil
+	}
+	if registry.Password != "" || registry.PasswordFrom == "" {
+		return registry.decryptField(ctx, FieldPassword)
+	}
+	return registry.resolveSecret(ctx, FieldPasswordFrom, registry.PasswordFrom)
+}
+
+// resolveSecret reads a secret source configured in the setting of the registry.
+// Commands and files are refused from the project-local config files that were
+// discovered rather than named, see checkDiscovered.
+func (r Registry) resolveSecret(ctx context.Context, setting, source string) (*secret.Secret, error) {
+	if scheme, _, _ := strings.Cut(source, ":"); scheme == "cmd" || scheme == "file" {
+		if err := r.checkDiscovered(setting); err != nil {
+			return nil, err
+		}
+	}
+	value, err := ResolveSecret(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("registry '%s': failed to resolve the %s: %w", r.Name, setting, err)
+	}
+	return value, nil
+}
+
+// hasSecret reports whether the secret field is available without prompting,
+// either configured or read from a source at login time
+func (r Registry) hasSecret(name string) bool {
+	return r.Field(name) != "" || (name == FieldPassword && r.PasswordFrom != "")
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFillSecretsKeepsPasswordUntilZeroed(t *testing.T) {
+	ctx := context.Background()
+	provider, err := GetProvider("docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HUB_PASSWORD", "hunter2")
+	registry := Registry{Name: "hub", Type: "docker", URL: "registry.example.com", Username: "me", PasswordFrom: "env:HUB_PASSWORD"}
+	if err := fillSecrets(ctx, "hub", provider, &registry); err != nil {
+		t.Fatal(err)
+	}
+	if registry.Password != "" || canRemember(registry) {
+		t.Errorf("a password read from a source is copied to the config (%q) or remembered", registry.Password)
+	}
+
+	// The login reads its own copy of the password read before, not the source again
+	t.Setenv("HUB_PASSWORD", "changed")
+	password, err := registryPassword(ctx, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password.Reveal() != "hunter2" {
+		t.Errorf("got password %q, want the one read by fillSecrets", password.Reveal())
+	}
+	password.Zero()
+	if registry.password.Reveal() != "hunter2" {
+		t.Error("zeroing the copy of the login zeroed the password of the registry")
+	}
+	registry.password.Zero()
+	if !registry.password.Empty() {
+		t.Error("the password of the registry is not zeroed")
+	}
+
+	plain := Registry{Name: "hub", Type: "docker", URL: "registry.example.com", Username: "me", Password: "hunter2"}
+	if err := fillSecrets(ctx, "hub", provider, &plain); err != nil {
+		t.Fatal(err)
+	}
+	defer plain.password.Zero()
+	if !canRemember(plain) {
+		t.Error("a password configured in plain text cannot be remembered")
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("REGISTRY_PASSWORD", "from env")
+	t.Setenv("EMPTY_PASSWORD", "")
+	t.Setenv(SecretStoreEnvVar, filepath.Join(home, "secrets.enc"))
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path="+filepath.Join(home, "no-bus"))
+	withPassphrase(t, "correct horse")
+	writeTestFile(t, filepath.Join(home, "password"), "from file\r\n")
+	writeTestFile(t, filepath.Join(home, "spaced"), " spaced \n\n")
+	err := UpdateSecretStore(context.Background(), func(entries map[string]string) error {
+		entries["harbor"] = "from store"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		source  string
+		want    string
+		wantErr string // Part of the expected error, empty when none
+	}{
+		{source: "env:REGISTRY_PASSWORD", want: "from env"},
+		{source: "env:MISSING_PASSWORD", wantErr: "environment variable MISSING_PASSWORD is not set"},
+		{source: "env:EMPTY_PASSWORD", wantErr: "secret source 'env:EMPTY_PASSWORD' is empty"},
+		{source: "file:" + filepath.Join(home, "password"), want: "from file"},
+		{source: "file:~/spaced", want: " spaced "},
+		{source: "file:~/missing", wantErr: "failed to read secret file"},
+		{source: "cmd:printf 'from cmd\\n'", want: "from cmd"},
+		{source: "cmd:echo oops >&2; exit 3", wantErr: "failed to run the secret command: exit status 3: oops"},
+		{source: "cmd:true", wantErr: "secret source 'cmd:true' is empty"},
+		{source: "store:harbor", want: "from store"},
+		{source: "store:quay", wantErr: "secret 'quay' not found in the secret store"},
+		{source: "keyring:hub", wantErr: "keyring"},
+		{source: "vault:hub", wantErr: "unknown secret source scheme 'vault'"},
+		{source: "REGISTRY_PASSWORD", wantErr: "invalid secret source 'REGISTRY_PASSWORD'"},
+		{source: "env:", wantErr: "invalid secret source 'env:'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			got, err := ResolveSecret(context.Background(), tt.source)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Reveal() != tt.want {
+				t.Errorf("got %q, want %q", got.Reveal(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+	"github.com/user-cube/auth-refresher/pkg/ui"
+)
+
+// SecretStoreEnvVar names the environment variable pointing at the secret store
+const SecretStoreEnvVar = "AUTH_REFRESHER_SECRETS_FILE"
+
+// PassphraseEnvVar names the environment variable holding the passphrase of the
+// encrypted files, for the daemon and other runs without a terminal
+const PassphraseEnvVar = "AUTH_REFRESHER_PASSPHRASE"
+
+// ErrPassphraseUnavailable is returned when a passphrase is needed but neither
+// set in the environment nor possible to prompt for
+var ErrPassphraseUnavailable = fmt.Errorf("no passphrase available: set %s or run in a terminal", PassphraseEnvVar)
+
+// secretStoreVersion is the version of the secret store format
+const secretStoreVersion = 1
+
+// secretStoreFile is the on-disk format of the secret store. Data holds the
+// entries as a JSON object, sealed with a key derived from the passphrase.
+type secretStoreFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Data       []byte `json:"data"`
+}
+
+// passphrase caches the passphrase once entered, so a batch login resolving
+// several stored secrets only prompts once. Only copies are handed out, so the
+// cached value can be forgotten while other logins are still using theirs.
+var passphrase struct {
+	sync.Mutex
+	value *secret.Secret
+}
+
+// derivedKeys caches the keys derived from the passphrase for each salt, so the
+// config file and the secret store are derived once per run however many values
+// they hold. Like the passphrase, only copies are handed out.
+var derivedKeys struct {
+	sync.Mutex
+	keys map[string]*secret.Secret
+}
+
+// SecretStorePath returns the encrypted secret store holding the `store:` secrets,
+// $AUTH_REFRESHER_SECRETS_FILE or secrets.enc under $XDG_DATA_HOME (~/.local/share)
+func SecretStorePath() string {
+	if path := os.Getenv(SecretStoreEnvVar); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return filepath.Join(dir, "auth-refresher", "secrets.enc")
+}
+
+// ReadPassphrase returns a copy of the passphrase of the encrypted files, from
+// the environment or asked once per run. When confirm is set, e.g. to encrypt a
+// new file, the prompt asks for it twice.
+func ReadPassphrase(ctx context.Context, confirm bool) (*secret.Secret, error) {
+	passphrase.Lock()
+	defer passphrase.Unlock()
+	if passphrase.value != nil {
+		return passphrase.value.Clone(), nil
+	}
+
+	if value, found := os.LookupEnv(PassphraseEnvVar); found && value != "" {
+		passphrase.value = secret.FromString(value)
+		return passphrase.value.Clone(), nil
+	}
+	if !ui.IsInteractive() {
+		return nil, ErrPassphraseUnavailable
+	}
+	value, err := ui.PromptInput(ctx, "Passphrase", true)
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		again, err := ui.PromptInput(ctx, "Confirm passphrase", true)
+		if err != nil {
+			return nil, err
+		}
+		if again != value {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+	}
+	if value == "" {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+	passphrase.value = secret.FromString(value)
+	return passphrase.value.Clone(), nil
+}
+
+// ForgetPassphrase drops the cached passphrase, e.g. after it failed to decrypt
+// a file. The copies handed out by ReadPassphrase are left to their owners.
+func ForgetPassphrase() {
+	passphrase.Lock()
+	cached := passphrase.value
+	passphrase.value = nil
+	passphrase.Unlock()
+	cached.Zero()
+}
+
+// derivedKeyID identifies a derived key in the cache
+func derivedKeyID(salt []byte, iterations int) string {
+	return fmt.Sprintf("%x:%d", salt, iterations)
+}
+
+// derivedKey returns a copy of the key derived from the passphrase and the salt,
+// asking for the passphrase if needed. When confirm is set the passphrase is
+// asked twice, see ReadPassphrase.
+func derivedKey(ctx context.Context, salt []byte, iterations int, confirm bool) (*secret.Secret, error) {
+	derivedKeys.Lock()
+	defer derivedKeys.Unlock()
+	id := derivedKeyID(salt, iterations)
+	if key, exists := derivedKeys.keys[id]; exists {
+		return key.Clone(), nil
+	}
+	pass, err := ReadPassphrase(ctx, confirm)
+	if err != nil {
+		return nil, err
+	}
+	defer pass.Zero()
+	key, err := secret.DeriveKey(pass, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	if derivedKeys.keys == nil {
+		derivedKeys.keys = make(map[string]*secret.Secret)
+	}
+	derivedKeys.keys[id] = key
+	return key.Clone(), nil
+}
+
+// forgetDerivedKey drops the cached key and the passphrase it was derived from,
+// e.g. after it failed to decrypt a value, so the next attempt asks again
+func forgetDerivedKey(salt []byte, iterations int) {
+	derivedKeys.Lock()
+	id := derivedKeyID(salt, iterations)
+	cached := derivedKeys.keys[id]
+	delete(derivedKeys.keys, id)
+	derivedKeys.Unlock()
+	cached.Zero()
+	ForgetPassphrase()
+}
+
+// decryptWithPassphrase opens data sealed with a key derived from the
+// passphrase. A wrong passphrase is forgotten so the next attempt asks again.
+func decryptWithPassphrase(ctx context.Context, salt []byte, iterations int, data []byte) ([]byte, error) {
+	key, err := derivedKey(ctx, salt, iterations, false)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+	plaintext, err := secret.Decrypt(key, data)
+	if errors.Is(err, secret.ErrDecrypt) {
+		forgetDerivedKey(salt, iterations)
+	}
+	return plaintext, err
+}
+
+// readSecretStore decrypts the entries of the secret store
+func readSecretStore(ctx context.Context, path string) (*secretStoreFile, map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("secret store %s does not exist, add secrets with `auth-refresher secrets set`: %w", path, err)
+		}
+		return nil, nil, fmt.Errorf("failed to open secret store: %w", err)
+	}
+	file := &secretStoreFile{}
+	if err := json.Unmarshal(raw, file); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse secret store %s: %w", path, err)
+	}
+	if file.Version != secretStoreVersion || file.KDF != "pbkdf2-sha256" || file.Iterations <= 0 {
+		return nil, nil, fmt.Errorf("secret store %s has an unsupported format (version %d, kdf %s)", path, file.Version, file.KDF)
+	}
+
+	plaintext, err := decryptWithPassphrase(ctx, file.Salt, file.Iterations, file.Data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt secret store %s: %w", path, err)
+	}
+	defer clear(plaintext)
+	entries := map[string]string{}
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse secret store %s: %w", path, err)
+	}
+	return file, entries, nil
+}
+
+// resolveStoredSecret reads the named entry of the secret store
+func resolveStoredSecret(ctx context.Context, name string) (*secret.Secret, error) {
+	path := SecretStorePath()
+	_, entries, err := readSecretStore(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	value, exists := entries[name]
+	if !exists {
+		return nil, fmt.Errorf("secret '%s' not found in the secret store %s", name, path)
+	}
+	return secret.FromString(value), nil
+}
+
+// StoredSecretNames returns the sorted names of the secrets in the secret store
+func StoredSecretNames(ctx context.Context) ([]string, error) {
+	_, entries, err := readSecretStore(ctx, SecretStorePath())
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// UpdateSecretStore applies fn to the entries of the secret store while holding
+// a lock, then encrypts them again. A missing store is only created once the
+// user agreed to it, and with a passphrase entered twice. Without a terminal it
+// is created with the passphrase of the environment.
+func UpdateSecretStore(ctx context.Context, fn func(entries map[string]string) error) error {
+	path := SecretStorePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create secret store directory: %w", err)
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, entries, err := readSecretStore(ctx, path)
+	created := errors.Is(err, os.ErrNotExist)
+	if created {
+		if file, err = newSecretStore(ctx, path); err != nil {
+			return err
+		}
+		entries = map[string]string{}
+	}
+	if err != nil {
+		return err
+	}
+	if err := fn(entries); err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode secret store: %w", err)
+	}
+	defer clear(plaintext)
+	key, err := derivedKey(ctx, file.Salt, file.Iterations, created)
+	if err != nil {
+		return err
+	}
+	defer key.Zero()
+	if file.Data, err = secret.Encrypt(key, plaintext); err != nil {
+		return fmt.Errorf("failed to encrypt secret store: %w", err)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode secret store: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write secret store: %w", err)
+	}
+	return nil
+}
+
+// newSecretStore returns the settings of a new secret store, once the user
+// agreed to create it. Its passphrase may be the one already entered for the
+// config file, so the prompt says so.
+func newSecretStore(ctx context.Context, path string) (*secretStoreFile, error) {
+	if ui.IsInteractive() {
+		created, err := ui.ConfirmWithContext(ctx, fmt.Sprintf("Create the secret store %s, sealed with the auth-refresher passphrase", path))
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			return nil, fmt.Errorf("secret store %s not created", path)
+		}
+	}
+	salt, err := secret.NewSalt()
+	if err != nil {
+		return nil, err
+	}
+	return &secretStoreFile{Version: secretStoreVersion, KDF: "pbkdf2-sha256", Iterations: secret.KeyIterations, Salt: salt}, nil
+}
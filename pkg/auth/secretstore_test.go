@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+func TestSecretStoreDerivesKeyOnce(t *testing.T) {
+	t.Setenv(SecretStoreEnvVar, filepath.Join(t.TempDir(), "secrets.enc"))
+	withPassphrase(t, "correct horse")
+	ctx := context.Background()
+
+	err := UpdateSecretStore(ctx, func(entries map[string]string) error {
+		entries["harbor"] = "hunter2"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		value, err := resolveStoredSecret(ctx, "harbor")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.Reveal() != "hunter2" {
+			t.Errorf("got %q", value.Reveal())
+		}
+	}
+	derivedKeys.Lock()
+	defer derivedKeys.Unlock()
+	if len(derivedKeys.keys) != 1 {
+		t.Errorf("got %d derived keys, want the store key derived once", len(derivedKeys.keys))
+	}
+}
+
+func TestSecretStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets", "secrets.enc")
+	t.Setenv(SecretStoreEnvVar, path)
+	withPassphrase(t, "correct horse")
+	ctx := context.Background()
+
+	if _, err := StoredSecretNames(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want a missing store", err)
+	}
+	set := func(entries map[string]string) error {
+		entries["quay"] = "s3cret"
+		entries["harbor"] = "hunter2"
+		return nil
+	}
+	if err := UpdateSecretStore(ctx, set); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("got permissions %s, want -rw-------", perm)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "hunter2") {
+		t.Errorf("the secret store holds a secret in plain text:\n%s", data)
+	}
+
+	// A failing update leaves the store as it was
+	failed := errors.New("failed")
+	err = UpdateSecretStore(ctx, func(entries map[string]string) error {
+		delete(entries, "quay")
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("got %v, want the error of the update", err)
+	}
+	if names, err := StoredSecretNames(ctx); err != nil || !slices.Equal(names, []string{"harbor", "quay"}) {
+		t.Errorf("got names %v, %v", names, err)
+	}
+
+	err = UpdateSecretStore(ctx, func(entries map[string]string) error {
+		delete(entries, "quay")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names, err := StoredSecretNames(ctx); err != nil || !slices.Equal(names, []string{"harbor"}) {
+		t.Errorf("got names %v, %v", names, err)
+	}
+
+	// Another passphrase cannot open the store
+	withPassphrase(t, "wrong")
+	if _, err := resolveStoredSecret(ctx, "harbor"); !errors.Is(err, secret.ErrDecrypt) {
+		t.Errorf("got %v, want a decryption error", err)
+	}
+	withPassphrase(t, "correct horse")
+	value, err := resolveStoredSecret(ctx, "harbor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.Reveal() != "hunter2" {
+		t.Errorf("got %q", value.Reveal())
+	}
+}
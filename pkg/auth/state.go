@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// State is the runtime state kept apart from the configuration file, so the
+// configuration can be checked into a dotfiles repository without churn
+type State struct {
+	CurrentRegistry string                   `yaml:"last_used_registry,omitempty"`
+	Registries      map[string]RegistryState `yaml:"registries,omitempty"`
+}
+
+// RegistryState is the runtime state of a single registry
+type RegistryState struct {
+	LastLogin  string `yaml:"last_login,omitempty"`
+	LastLogout string `yaml:"last_logout,omitempty"`
+	ExpiresAt  string `yaml:"expires_at,omitempty"`
+}
+
+// StatePath returns the state file of the given configuration file. It lives
+// under $XDG_STATE_HOME (~/.local/state by default) and is named after the
+// absolute configuration path, so every configuration gets its own state.
+func StatePath(configPath string) string {
+	if abs, err := filepath.Abs(configPath); err == nil {
+		configPath = abs
+	}
+	sum := sha256.Sum256([]byte(configPath))
+	return filepath.Join(stateDir(), hex.EncodeToString(sum[:8])+".yaml")
+}
+
+// stateDir is the directory of the files auth-refresher keeps for itself
+func stateDir() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".local", "state")
+	}
+	return filepath.Join(dir, "auth-refresher")
+}
+
+// applyState copies the runtime state onto the registries of the configuration
+func (c *Config) applyState(state *State) {
+	c.CurrentRegistry = state.CurrentRegistry
+	for key, registryState := range state.Registries {
+		registry, exists := c.Registries[key]
+		if !exists {
+			continue
+		}
+		registry.LastLogin = registryState.LastLogin
+		registry.LastLogout = registryState.LastLogout
+		registry.ExpiresAt = registryState.ExpiresAt
+		c.Registries[key] = registry
+	}
+}
+
+// state extracts the runtime state of the configuration. Removed registries are
+// dropped, so the state file never outlives the configuration entries.
+func (c *Config) state() *State {
+	state := &State{CurrentRegistry: c.CurrentRegistry}
+	for key, registry := range c.Registries {
+		registryState := RegistryState{
+			LastLogin:  registry.LastLogin,
+			LastLogout: registry.LastLogout,
+			ExpiresAt:  registry.ExpiresAt,
+		}
+		if registryState == (RegistryState{}) {
+			continue
+		}
+		if state.Registries == nil {
+			state.Registries = make(map[string]RegistryState)
+		}
+		state.Registries[key] = registryState
+	}
+	return state
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lockTimeout is how long to wait for another process to release the configuration
+const lockTimeout = 10 * time.Second
+
+// ErrConfigLocked is returned when the configuration stays locked by another process
+var ErrConfigLocked = errors.New("config file is locked by another auth-refresher process")
+
+// storedConfig is a configuration as read from disk, with the raw file contents
+// to tell later whether anything needs to be written back
+type storedConfig struct {
+	config      *Config
+	raw         []byte
+	rawState    []byte
+	fromVersion int
+}
+
+// LoadConfig loads the configuration from the given file path, along with its
+// state file. Files written by older releases are migrated to the current schema
+// and saved back, keeping a backup of the original next to it.
+func LoadConfig(filePath string) (*Config, error) {
+	stored, err := readConfig(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if stored.fromVersion == CurrentConfigVersion {
+		return stored.config, nil
+	}
+
+	// Persist the migration under the lock, the file is read again there. Files of
+	// older releases have no encryption settings, so nothing is sealed.
+	var config *Config
+	err = UpdateConfig(context.Background(), filePath, func(c *Config) error {
+		config = c
+		return nil
+	})
+	return config, err
+}
+
+// UpdateConfig applies fn to the configuration stored at filePath while holding
+// an advisory lock, then writes the result atomically. The configuration is read
+// inside the lock, so concurrent updates (e.g. two terminals logging in at once)
+// each apply their own change on top of the others instead of clobbering them.
+// Only the files that changed are written, so a login touches the state file
+// but not the configuration. A missing file is treated as an empty configuration.
+// ctx bounds the passphrase prompt needed to seal new sensitive values of an
+// encrypted configuration.
+func UpdateConfig(ctx context.Context, filePath string, fn func(config *Config) error) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	unlock, err := lockFile(filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stored, err := readConfig(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		stored, err = &storedConfig{
+			config:      &Config{Version: CurrentConfigVersion, Registries: make(map[string]Registry)},
+			fromVersion: CurrentConfigVersion,
+		}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := fn(stored.config); err != nil {
+		return err
+	}
+
+	if stored.fromVersion != CurrentConfigVersion && len(stored.raw) > 0 {
+		backup := migrationBackupPath(filePath, stored.fromVersion)
+		if _, err := os.Stat(backup); errors.Is(err, os.ErrNotExist) {
+			if err := writeFileAtomic(backup, stored.raw, 0600); err != nil {
+				return fmt.Errorf("failed to back up config file before migrating it: %w", err)
+			}
+		}
+	}
+	return writeConfig(ctx, filePath, stored.config, stored.raw, stored.rawState)
+}
+
+// SaveConfig writes the configuration and its state file atomically, through
+// temporary files readable only by the user. Use UpdateConfig to modify an
+// existing configuration safely.
+func SaveConfig(ctx context.Context, filePath string, config *Config) error {
+	return writeConfig(ctx, filePath, config, nil, nil)
+}
+
+// readConfig reads and migrates the configuration file and applies its state file
+func readConfig(filePath string) (*storedConfig, error) {
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	rawState, err := os.ReadFile(StatePath(filePath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+
+	state := &State{}
+	if err := yaml.Unmarshal(rawState, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	doc := map[string]any{}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(doc) == 0 {
+		// An empty file is a brand new configuration
+		doc = map[string]any{"version": CurrentConfigVersion}
+	}
+	fromVersion, err := migrateDocument(doc, state)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the migrated document into the typed configuration
+	migrated, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	config := &Config{}
+	if err := yaml.Unmarshal(migrated, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if config.Registries == nil {
+		config.Registries = make(map[string]Registry)
+	}
+	config.applyState(state)
+	config.applyEncryption()
+	config.applyDiscovered(filePath)
+
+	return &storedConfig{config: config, raw: raw, rawState: rawState, fromVersion: fromVersion}, nil
+}
+
+// writeConfig writes the configuration and its state file, skipping the ones
+// whose contents did not change. The sensitive values of an encrypted
+// configuration are sealed when the configuration file is written, so writes
+// of the state alone, such as the ones of logins, never need the passphrase.
+func writeConfig(ctx context.Context, filePath string, config *Config, raw, rawState []byte) error {
+	config.Version = CurrentConfigVersion
+	data, err := encodeYAML(config)
+	if err != nil {
+		return fmt.Errorf("failed to write updated config: %w", err)
+	}
+	changed := raw == nil || !bytes.Equal(data, raw)
+	if changed {
+		sealed, err := config.sealSensitiveFields(ctx)
+		if err != nil {
+			return err
+		}
+		if sealed > 0 {
+			if data, err = encodeYAML(config); err != nil {
+				return fmt.Errorf("failed to write updated config: %w", err)
+			}
+		}
+	}
+	stateData, err := encodeYAML(config.state())
+	if err != nil {
+		return fmt.Errorf("failed to write updated state: %w", err)
+	}
+
+	if changed {
+		if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+			return fmt.Errorf("failed to create config directory: %w", err)
+		}
+		if err := writeFileAtomic(filePath, data, 0600); err != nil {
+			return fmt.Errorf("failed to write updated config: %w", err)
+		}
+	}
+	if rawState == nil || !bytes.Equal(stateData, rawState) {
+		statePath := StatePath(filePath)
+		if err := os.MkdirAll(filepath.Dir(statePath), 0700); err != nil {
+			return fmt.Errorf("failed to create state directory: %w", err)
+		}
+		if err := writeFileAtomic(statePath, stateData, 0600); err != nil {
+			return fmt.Errorf("failed to write updated state: %w", err)
+		}
+	}
+	return nil
+}
+
+// encodeYAML encodes a value the way every auth-refresher file is written
+func encodeYAML(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFileAtomic replaces the file with data by writing a temporary file in the
+// same directory and renaming it, so readers never see a partially written file.
+// A symlinked file (e.g. a config kept in a dotfiles repository) has its target
+// replaced, the link is kept.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// testConfigPath returns a configuration path in a temporary home, with the
+// state files kept in it too
+func testConfigPath(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	return filepath.Join(home, ".auth-refresher", "config.yaml")
+}
+
+func TestUpdateConfigConcurrently(t *testing.T) {
+	configPath := testConfigPath(t)
+	const updates = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, updates)
+	for i := range updates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- UpdateConfig(context.Background(), configPath, func(config *Config) error {
+				name := fmt.Sprintf("registry-%d", i)
+				config.Registries[name] = Registry{Name: name, Type: "docker", URL: name + ".example.com"}
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Registries) != updates {
+		t.Errorf("got %d registries, want %d: an update was lost", len(config.Registries), updates)
+	}
+}
+
+func TestWriteFileAtomicKeepsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "config.yaml")
+	link := filepath.Join(dir, "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(link, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the symlink was replaced: %v", err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "new" {
+		t.Errorf("got target %q, %v", data, err)
+	}
+}
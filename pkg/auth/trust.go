@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrDiscoveredConfig is returned when a setting running a command or reading a
+// file comes from a configuration that was discovered rather than named
+var ErrDiscoveredConfig = errors.New("not allowed in a project-local config file found in the working directory, name the file with --config to use it")
+
+// trustedConfigs is the list of project-local configuration files the user
+// agreed to use, kept in the state directory
+type trustedConfigs struct {
+	Paths []string `yaml:"paths"`
+}
+
+// discoveredConfigs holds the project-local files picked by ConfigPath
+var discoveredConfigs struct {
+	sync.Mutex
+	paths map[string]bool
+}
+
+// trustFilePath is the file listing the trusted project-local configurations
+func trustFilePath() string {
+	return filepath.Join(stateDir(), "trusted.yaml")
+}
+
+// absPath returns the absolute form of path, or path itself when it cannot be resolved
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// IsTrustedConfig reports whether the project-local configuration was trusted with TrustConfig
+func IsTrustedConfig(path string) bool {
+	trusted, err := readTrustedConfigs()
+	return err == nil && slices.Contains(trusted.Paths, absPath(path))
+}
+
+// TrustConfig records whether the project-local configuration may be picked up
+// when running auth-refresher from its directory
+func TrustConfig(path string, trust bool) error {
+	file := trustFilePath()
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	unlock, err := lockFile(file + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	trusted, err := readTrustedConfigs()
+	if err != nil {
+		return err
+	}
+	path = absPath(path)
+	trusted.Paths = slices.DeleteFunc(trusted.Paths, func(p string) bool { return p == path })
+	if trust {
+		trusted.Paths = append(trusted.Paths, path)
+		slices.Sort(trusted.Paths)
+	}
+	data, err := encodeYAML(trusted)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(file, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return nil
+}
+
+// readTrustedConfigs reads the trusted project-local configurations, none when
+// nothing was trusted yet
+func readTrustedConfigs() (*trustedConfigs, error) {
+	trusted := &trustedConfigs{}
+	data, err := os.ReadFile(trustFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return trusted, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the trusted config files: %w", err)
+	}
+	if err := yaml.Unmarshal(data, trusted); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", trustFilePath(), err)
+	}
+	return trusted, nil
+}
+
+// markDiscovered records whether the configuration was found rather than named
+func markDiscovered(path string, discovered bool) {
+	discoveredConfigs.Lock()
+	defer discoveredConfigs.Unlock()
+	if discoveredConfigs.paths == nil {
+		discoveredConfigs.paths = make(map[string]bool)
+	}
+	discoveredConfigs.paths[absPath(path)] = discovered
+}
+
+// isDiscovered reports whether the configuration was found by ConfigPath rather than named
+func isDiscovered(path string) bool {
+	discoveredConfigs.Lock()
+	defer discoveredConfigs.Unlock()
+	return discoveredConfigs.paths[absPath(path)]
+}
+
+// applyDiscovered flags the registries of a discovered configuration, see checkDiscovered
+func (c *Config) applyDiscovered(path string) {
+	if !isDiscovered(path) {
+		return
+	}
+	for key, registry := range c.Registries {
+		registry.discovered = true
+		c.Registries[key] = registry
+	}
+}
+
+// checkDiscovered refuses a setting running a command or reading a file when
+// the registry comes from a discovered project-local configuration: anyone able
+// to commit to a repository could otherwise run code through `docker pull`.
+func (r Registry) checkDiscovered(setting string) error {
+	if r.discovered {
+		return fmt.Errorf("registry '%s': %s is %w", r.Name, setting, ErrDiscoveredConfig)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// inDir runs the test from dir
+func inDir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(previous) })
+}
+
+func TestConfigPathProjectConfig(t *testing.T) {
+	home := filepath.Dir(testConfigPath(t))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv(ConfigEnvVar, "")
+	repo := filepath.Join(home, "repo")
+	project := filepath.Join(repo, ProjectConfigName)
+	writeTestFile(t, project, "version: 2\nregistries: {}\n")
+	subdir := filepath.Join(repo, "sub")
+	if err := os.MkdirAll(subdir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	userConfig := xdgConfigPath()
+
+	inDir(t, repo)
+	if path := ConfigPath(""); path != userConfig {
+		t.Errorf("untrusted project config used: %s", path)
+	}
+	if err := TrustConfig(ProjectConfigName, true); err != nil {
+		t.Fatal(err)
+	}
+	if path := ConfigPath(""); absPath(path) != absPath(project) {
+		t.Errorf("got %s, want the trusted project config", path)
+	}
+	if path := ConfigPath("explicit.yaml"); path != "explicit.yaml" {
+		t.Errorf("got %s, want the explicit path", path)
+	}
+
+	// Parent directories are not searched, even when trusted
+	inDir(t, subdir)
+	if path := ConfigPath(""); path != userConfig {
+		t.Errorf("project config of a parent directory used: %s", path)
+	}
+
+	if err := TrustConfig(project, false); err != nil {
+		t.Fatal(err)
+	}
+	inDir(t, repo)
+	if path := ConfigPath(""); path != userConfig {
+		t.Errorf("revoked project config used: %s", path)
+	}
+}
+
+func TestDiscoveredConfigRefusesCommands(t *testing.T) {
+	home := filepath.Dir(testConfigPath(t))
+	t.Setenv(ConfigEnvVar, "")
+	repo := filepath.Join(home, "repo")
+	marker := filepath.Join(home, "ran")
+	writeTestFile(t, filepath.Join(repo, ProjectConfigName), `version: 2
+registries:
+  hub:
+    name: hub
+    type: docker
+    url: registry.example.com
+    username: me
+    password_from: "cmd:touch `+marker+`; echo hunter2"
+  charts:
+    name: charts
+    type: helm
+    auth: token
+    url: https://charts.example.com
+    username: me
+    token_command: "touch `+marker+`"
+  gar:
+    name: gar
+    type: gcp
+    url: europe-west1-docker.pkg.dev
+    token_source: key
+    key_file: /etc/passwd
+`)
+	inDir(t, repo)
+	if err := TrustConfig(ProjectConfigName, true); err != nil {
+		t.Fatal(err)
+	}
+	discovered := ConfigPath("")
+	config, err := LoadConfig(discovered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, key := range []string{"hub", "charts", "gar"} {
+		if _, err := Login(ctx, config.Registries[key]); !errors.Is(err, ErrDiscoveredConfig) {
+			t.Errorf("%s: got %v, want ErrDiscoveredConfig", key, err)
+		}
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("a command of the discovered config ran")
+	}
+
+	// Named explicitly, the same file may run its commands
+	named, err := LoadConfig(ConfigPath(filepath.Join(repo, ProjectConfigName)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, err := registryPassword(ctx, named.Registries["hub"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password.Reveal() != "hunter2" {
+		t.Errorf("got password %q", password.Reveal())
+	}
+}
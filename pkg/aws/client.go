@@ -0,0 +1,90 @@
+// Package aws implements the small part of the AWS APIs auth-refresher needs to
+// mint ECR tokens without the AWS CLI: credentials resolution from the
+// environment and the shared files, STS AssumeRole and ECR
+// GetAuthorizationToken, signed with Signature Version 4.
+package aws
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds every call to an AWS API
+const requestTimeout = 30 * time.Second
+
+// Client calls the AWS APIs. The endpoints default to the regional public ones
+// and can be pointed at a local stand-in, e.g. for testing.
+type Client struct {
+	HTTPClient  *http.Client
+	ECREndpoint string // Base URL of the ECR API, empty for the regional endpoint
+	STSEndpoint string // Base URL of the STS API, empty for the regional endpoint
+}
+
+// NewClient returns a client honouring the AWS_ENDPOINT_URL_ECR,
+// AWS_ENDPOINT_URL_STS and AWS_ENDPOINT_URL endpoint overrides of the AWS SDKs
+func NewClient() *Client {
+	return &Client{
+		HTTPClient:  &http.Client{Timeout: requestTimeout},
+		ECREndpoint: endpointOverride("AWS_ENDPOINT_URL_ECR"),
+		STSEndpoint: endpointOverride("AWS_ENDPOINT_URL_STS"),
+	}
+}
+
+// endpointOverride returns the service specific endpoint variable, or the global one
+func endpointOverride(variable string) string {
+	if endpoint := os.Getenv(variable); endpoint != "" {
+		return endpoint
+	}
+	return os.Getenv("AWS_ENDPOINT_URL")
+}
+
+// regionalEndpoint returns the public endpoint of a service in a region
+func regionalEndpoint(service, region string) string {
+	endpoint := fmt.Sprintf("https://%s.%s.amazonaws.com", service, region)
+	if strings.HasPrefix(region, "cn-") {
+		endpoint += ".cn"
+	}
+	return endpoint
+}
+
+// do sends a signed POST request to an AWS API and returns the response body.
+// Responses outside of the 2xx range are returned as an error by decodeError.
+func (c *Client) do(ctx context.Context, endpoint, service, region string, creds Credentials, headers map[string]string, body []byte, decodeError func(status int, body []byte) error) (_ []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	signRequest(req, body, creds, region, service, time.Now())
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the %s response: %w", service, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, decodeError(resp.StatusCode, data)
+	}
+	return data, nil
+}
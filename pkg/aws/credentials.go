@@ -0,0 +1,220 @@
+package aws
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxSourceProfiles bounds the chain of source_profile references of a profile
+const maxSourceProfiles = 5
+
+// DefaultRoleSessionName is the session name of assumed roles when none is configured
+const DefaultRoleSessionName = "auth-refresher"
+
+// ErrNoCredentials is returned when neither the environment nor the shared
+// files hold credentials
+var ErrNoCredentials = errors.New("no AWS credentials found in the environment or the shared credentials files")
+
+// ErrUnsupportedProfile is returned for profiles relying on credential sources
+// that are only available through the AWS CLI, such as SSO or credential_process
+var ErrUnsupportedProfile = errors.New("profile uses a credential source that is not supported natively")
+
+// Credentials are AWS access keys, temporary when SessionToken is set
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time // Zero for long term credentials
+}
+
+// profile holds the settings of a profile merged from the config and credentials files
+type profile map[string]string
+
+// Credentials resolves the credentials of a profile. Without an explicit profile,
+// the AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY environment variables win, then
+// AWS_PROFILE and finally the default profile. Profiles assuming a role through
+// role_arn and source_profile (or credential_source = Environment) are
+// resolved with STS in the given region.
+func (c *Client) Credentials(ctx context.Context, name, region string) (Credentials, error) {
+	if name == "" {
+		if creds, ok := environmentCredentials(); ok {
+			return creds, nil
+		}
+		name = os.Getenv("AWS_PROFILE")
+	}
+	if name == "" {
+		name = "default"
+	}
+
+	profiles, err := loadProfiles()
+	if err != nil {
+		return Credentials{}, err
+	}
+	return c.profileCredentials(ctx, profiles, name, region, 0)
+}
+
+// profileCredentials resolves a profile, following its source_profile chain
+func (c *Client) profileCredentials(ctx context.Context, profiles map[string]profile, name, region string, depth int) (Credentials, error) {
+	if depth > maxSourceProfiles {
+		return Credentials{}, fmt.Errorf("profile '%s': too many nested source_profile references", name)
+	}
+	settings, exists := profiles[name]
+	if !exists {
+		if name == "default" {
+			return Credentials{}, ErrNoCredentials
+		}
+		return Credentials{}, fmt.Errorf("profile '%s' not found in the shared config and credentials files", name)
+	}
+
+	if roleARN := settings["role_arn"]; roleARN != "" {
+		var source Credentials
+		var err error
+		switch {
+		case settings["source_profile"] == name:
+			source, err = staticCredentials(name, settings) // A profile can hold the keys used to assume its own role
+		case settings["source_profile"] != "":
+			source, err = c.profileCredentials(ctx, profiles, settings["source_profile"], region, depth+1)
+		case strings.EqualFold(settings["credential_source"], "Environment"):
+			var ok bool
+			if source, ok = environmentCredentials(); !ok {
+				err = fmt.Errorf("profile '%s': %w", name, ErrNoCredentials)
+			}
+		default:
+			err = fmt.Errorf("profile '%s': %w", name, ErrUnsupportedProfile)
+		}
+		if err != nil {
+			return Credentials{}, err
+		}
+		if settings["region"] != "" {
+			region = settings["region"]
+		}
+		return c.AssumeRole(ctx, source, region, AssumeRoleInput{
+			RoleARN:     roleARN,
+			SessionName: settings["role_session_name"],
+			ExternalID:  settings["external_id"],
+		})
+	}
+
+	if settings["aws_access_key_id"] != "" {
+		return staticCredentials(name, settings)
+	}
+	for _, key := range []string{"sso_start_url", "sso_session", "credential_process", "credential_source", "web_identity_token_file"} {
+		if settings[key] != "" {
+			return Credentials{}, fmt.Errorf("profile '%s' (%s): %w", name, key, ErrUnsupportedProfile)
+		}
+	}
+	return Credentials{}, fmt.Errorf("profile '%s': %w", name, ErrNoCredentials)
+}
+
+// staticCredentials reads the access keys of a profile
+func staticCredentials(name string, settings profile) (Credentials, error) {
+	creds := Credentials{
+		AccessKeyID:     settings["aws_access_key_id"],
+		SecretAccessKey: settings["aws_secret_access_key"],
+		SessionToken:    settings["aws_session_token"],
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("profile '%s' has an incomplete access key: %w", name, ErrNoCredentials)
+	}
+	return creds, nil
+}
+
+// environmentCredentials reads the access keys from the standard environment variables
+func environmentCredentials() (Credentials, bool) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, false
+	}
+	return creds, true
+}
+
+// loadProfiles reads the shared config and credentials files. Settings of the
+// credentials file take precedence, like in the AWS CLI.
+func loadProfiles() (map[string]profile, error) {
+	home, _ := os.UserHomeDir()
+	configPath := os.Getenv("AWS_CONFIG_FILE")
+	if configPath == "" {
+		configPath = filepath.Join(home, ".aws", "config")
+	}
+	credentialsPath := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsPath == "" {
+		credentialsPath = filepath.Join(home, ".aws", "credentials")
+	}
+
+	profiles := map[string]profile{}
+	if err := parseProfiles(configPath, true, profiles); err != nil {
+		return nil, err
+	}
+	if err := parseProfiles(credentialsPath, false, profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// parseProfiles merges the sections of an ini file into profiles. Sections of
+// the config file are named "profile <name>", except for the default profile.
+func parseProfiles(path string, configFile bool, profiles map[string]profile) (err error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open AWS file: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	var current profile
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			name := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			if configFile && name != "default" {
+				var found bool
+				if name, found = strings.CutPrefix(name, "profile "); !found {
+					current = nil // sso-session and services sections are not profiles
+					continue
+				}
+				name = strings.TrimSpace(name)
+			}
+			if profiles[name] == nil {
+				profiles[name] = profile{}
+			}
+			current = profiles[name]
+			continue
+		}
+
+		// Indented lines are nested settings (e.g. s3 = ...), not used here
+		if current == nil || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		key, value, found := strings.Cut(trimmed, "=")
+		if !found {
+			continue
+		}
+		current[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read AWS file %s: %w", path, err)
+	}
+	return nil
+}
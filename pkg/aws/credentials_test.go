@@ -0,0 +1,214 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfigFile = `# Shared config file
+[default]
+region = eu-west-1
+
+[profile dev]
+region = us-east-1
+s3 =
+  max_concurrent_requests = 10
+
+[profile chain]
+role_arn = arn:aws:iam::111111111111:role/chain
+source_profile = middle
+
+[profile middle]
+role_arn = arn:aws:iam::222222222222:role/middle
+source_profile = base
+role_session_name = ci
+
+[profile self]
+role_arn = arn:aws:iam::333333333333:role/self
+source_profile = self
+aws_access_key_id = AKIDSELF
+aws_secret_access_key = self-secret
+
+[profile sso]
+sso_start_url = https://example.awsapps.com/start
+
+[profile instance]
+role_arn = arn:aws:iam::444444444444:role/instance
+credential_source = Ec2InstanceMetadata
+
+[profile loop-a]
+role_arn = arn:aws:iam::555555555555:role/a
+source_profile = loop-b
+
+[profile loop-b]
+role_arn = arn:aws:iam::555555555555:role/b
+source_profile = loop-a
+
+[sso-session corp]
+sso_region = eu-west-1
+`
+
+const testCredentialsFile = `[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = default-secret
+
+[dev]
+aws_access_key_id = AKIDDEV
+aws_secret_access_key = dev-secret
+region = eu-central-1
+
+[base]
+aws_access_key_id = AKIDBASE
+aws_secret_access_key = base-secret
+`
+
+// withSharedFiles points the AWS shared files at temporary copies and clears
+// the credentials of the environment
+func withSharedFiles(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+	credentialsPath := filepath.Join(dir, "credentials")
+	if err := os.WriteFile(configPath, []byte(testConfigFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(credentialsPath, []byte(testCredentialsFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configPath)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsPath)
+	for _, name := range []string{"AWS_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestParseProfiles(t *testing.T) {
+	withSharedFiles(t)
+	profiles, err := loadProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The credentials file wins over the config file, nested settings are skipped
+	want := profile{"region": "eu-central-1", "s3": "", "aws_access_key_id": "AKIDDEV", "aws_secret_access_key": "dev-secret"}
+	if !reflect.DeepEqual(profiles["dev"], want) {
+		t.Errorf("got dev profile %v, want %v", profiles["dev"], want)
+	}
+	if profiles["default"]["region"] != "eu-west-1" || profiles["default"]["aws_access_key_id"] != "AKIDDEFAULT" {
+		t.Errorf("got default profile %v", profiles["default"])
+	}
+	if _, exists := profiles["corp"]; exists {
+		t.Error("sso-session sections are not profiles")
+	}
+	if _, exists := profiles["sso-session corp"]; exists {
+		t.Error("sso-session sections are not profiles")
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	withSharedFiles(t)
+	client, calls := stsStandIn(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		profile   string
+		env       map[string]string
+		want      string   // Access key ID of the credentials
+		signedBy  []string // Access keys signing the AssumeRole calls, in order
+		wantRoles []string
+	}{
+		{name: "default profile", want: "AKIDDEFAULT"},
+		{name: "AWS_PROFILE", env: map[string]string{"AWS_PROFILE": "dev"}, want: "AKIDDEV"},
+		{name: "environment keys win", env: map[string]string{"AWS_PROFILE": "dev", "AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "env"}, want: "AKIDENV"},
+		{name: "explicit profile over environment keys", profile: "dev", env: map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "env"}, want: "AKIDDEV"},
+		{
+			name:      "source_profile chain",
+			profile:   "chain",
+			want:      "ASIAchain",
+			signedBy:  []string{"AKIDBASE", "ASIAmiddle"},
+			wantRoles: []string{"arn:aws:iam::222222222222:role/middle", "arn:aws:iam::111111111111:role/chain"},
+		},
+		{
+			name:      "role assumed with its own keys",
+			profile:   "self",
+			want:      "ASIAself",
+			signedBy:  []string{"AKIDSELF"},
+			wantRoles: []string{"arn:aws:iam::333333333333:role/self"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			*calls = nil
+			creds, err := client.Credentials(ctx, tt.profile, "eu-west-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.AccessKeyID != tt.want {
+				t.Errorf("got credentials %s, want %s", creds.AccessKeyID, tt.want)
+			}
+			var signedBy, roles []string
+			for _, call := range *calls {
+				signedBy = append(signedBy, call.accessKeyID)
+				roles = append(roles, call.form["RoleArn"])
+			}
+			if !reflect.DeepEqual(signedBy, tt.signedBy) || !reflect.DeepEqual(roles, tt.wantRoles) {
+				t.Errorf("assumed %v signed by %v, want %v signed by %v", roles, signedBy, tt.wantRoles, tt.signedBy)
+			}
+		})
+	}
+	if len(*calls) > 0 && (*calls)[0].form["RoleSessionName"] != DefaultRoleSessionName {
+		t.Errorf("got session name %s", (*calls)[0].form["RoleSessionName"])
+	}
+}
+
+func TestCredentialsErrors(t *testing.T) {
+	withSharedFiles(t)
+	client, _ := stsStandIn(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		profile string
+		is      error
+		message string
+	}{
+		{profile: "sso", is: ErrUnsupportedProfile},
+		{profile: "instance", is: ErrUnsupportedProfile},
+		{profile: "loop-a", message: "too many nested source_profile references"},
+		{profile: "missing", message: "profile 'missing' not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			_, err := client.Credentials(ctx, tt.profile, "eu-west-1")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("got %v, want %v", err, tt.is)
+			}
+			if tt.message != "" && !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("got %v, want an error containing %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestCredentialsWithoutFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	for _, name := range []string{"AWS_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+		t.Setenv(name, "")
+	}
+	if _, err := NewClient().Credentials(context.Background(), "", "eu-west-1"); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("got %v, want ErrNoCredentials", err)
+	}
+}
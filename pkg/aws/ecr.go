@@ -0,0 +1,93 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// AuthorizationToken is a Docker credential for the ECR registries of an account
+type AuthorizationToken struct {
+	Username      string
+	Password      *secret.Secret
+	ExpiresAt     time.Time
+	ProxyEndpoint string // Registry URL the token was issued for
+}
+
+// GetAuthorizationToken calls the ECR GetAuthorizationToken API and decodes the
+// base64 encoded "AWS:<token>" credential it returns
+func (c *Client) GetAuthorizationToken(ctx context.Context, creds Credentials, region string) (AuthorizationToken, error) {
+	endpoint := c.ECREndpoint
+	if endpoint == "" {
+		endpoint = regionalEndpoint("api.ecr", region)
+	}
+	headers := map[string]string{
+		"Content-Type": "application/x-amz-json-1.1",
+		"X-Amz-Target": "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken",
+	}
+	data, err := c.do(ctx, endpoint, "ecr", region, creds, headers, []byte("{}"), decodeJSONError)
+	if err != nil {
+		return AuthorizationToken{}, fmt.Errorf("ECR GetAuthorizationToken failed: %w", err)
+	}
+
+	var response struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"` // Seconds since the epoch
+			ProxyEndpoint      string  `json:"proxyEndpoint"`
+		} `json:"authorizationData"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return AuthorizationToken{}, fmt.Errorf("failed to parse the ECR response: %w", err)
+	}
+	if len(response.AuthorizationData) == 0 {
+		return AuthorizationToken{}, fmt.Errorf("ECR returned no authorization data")
+	}
+
+	authData := response.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(authData.AuthorizationToken)
+	if err != nil {
+		return AuthorizationToken{}, fmt.Errorf("failed to decode the ECR authorization token: %w", err)
+	}
+	defer clear(decoded)
+	username, password, found := bytes.Cut(decoded, []byte(":"))
+	if !found {
+		return AuthorizationToken{}, fmt.Errorf("ECR authorization token is not a username:password pair")
+	}
+
+	seconds, fraction := math.Modf(authData.ExpiresAt)
+	return AuthorizationToken{
+		Username:      string(username),
+		Password:      secret.New(bytes.Clone(password)),
+		ExpiresAt:     time.Unix(int64(seconds), int64(fraction*1e9)),
+		ProxyEndpoint: authData.ProxyEndpoint,
+	}, nil
+}
+
+// decodeJSONError turns an error response of the JSON protocol APIs into an error
+func decodeJSONError(status int, body []byte) error {
+	var response struct {
+		Type       string `json:"__type"`
+		Message    string `json:"message"`
+		MessageCap string `json:"Message"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.Type == "" {
+		return fmt.Errorf("HTTP %d: %s", status, strings.TrimSpace(string(body)))
+	}
+	// The error type may be prefixed with a namespace, e.g. "com.amazonaws.ecr#..."
+	if _, code, found := strings.Cut(response.Type, "#"); found {
+		response.Type = code
+	}
+	message := response.Message
+	if message == "" {
+		message = response.MessageCap
+	}
+	return fmt.Errorf("%s: %s", response.Type, message)
+}
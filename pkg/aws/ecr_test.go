@@ -0,0 +1,77 @@
+package aws
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCreds = Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}
+
+// ecrStandIn serves GetAuthorizationToken with the given status and body
+func ecrStandIn(t *testing.T, status int, body string) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target := r.Header.Get("X-Amz-Target"); target != "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken" {
+			t.Errorf("unexpected X-Amz-Target %s", target)
+		}
+		if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/ecr/") {
+			t.Errorf("unexpected Authorization %s", auth)
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return &Client{ECREndpoint: server.URL}
+}
+
+func TestGetAuthorizationToken(t *testing.T) {
+	token := base64.StdEncoding.EncodeToString([]byte("AWS:hunter2:with:colons"))
+	client := ecrStandIn(t, http.StatusOK, `{"authorizationData":[{"authorizationToken":"`+token+
+		`","expiresAt":1700000000.5,"proxyEndpoint":"https://123456789012.dkr.ecr.eu-west-1.amazonaws.com"}]}`)
+
+	got, err := client.GetAuthorizationToken(context.Background(), testCreds, "eu-west-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Password.Zero()
+	if got.Username != "AWS" || got.Password.Reveal() != "hunter2:with:colons" {
+		t.Errorf("got %s:%s", got.Username, got.Password.Reveal())
+	}
+	if want := time.Unix(1700000000, 500_000_000); !got.ExpiresAt.Equal(want) {
+		t.Errorf("got expiry %v, want %v", got.ExpiresAt, want)
+	}
+	if got.ProxyEndpoint != "https://123456789012.dkr.ecr.eu-west-1.amazonaws.com" {
+		t.Errorf("got proxy endpoint %s", got.ProxyEndpoint)
+	}
+}
+
+func TestGetAuthorizationTokenErrors(t *testing.T) {
+	notAPair := base64.StdEncoding.EncodeToString([]byte("no-separator"))
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"namespaced type", http.StatusBadRequest, `{"__type":"com.amazonaws.ecr#AccessDeniedException","message":"not allowed"}`, "AccessDeniedException: not allowed"},
+		{"capitalized message", http.StatusBadRequest, `{"__type":"ExpiredTokenException","Message":"expired"}`, "ExpiredTokenException: expired"},
+		{"not JSON", http.StatusInternalServerError, "oops", "HTTP 500: oops"},
+		{"no data", http.StatusOK, `{"authorizationData":[]}`, "no authorization data"},
+		{"invalid base64", http.StatusOK, `{"authorizationData":[{"authorizationToken":"%%%"}]}`, "failed to decode"},
+		{"not a pair", http.StatusOK, `{"authorizationData":[{"authorizationToken":"` + notAPair + `"}]}`, "not a username:password pair"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := ecrStandIn(t, tt.status, tt.body)
+			_, err := client.GetAuthorizationToken(context.Background(), testCreds, "eu-west-1")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package aws
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AssumeRoleInput describes the role to assume
+type AssumeRoleInput struct {
+	RoleARN     string
+	SessionName string // auth-refresher when empty
+	ExternalID  string // Only when the trust policy of the role requires it
+}
+
+// AssumeRole calls the STS AssumeRole API with the source credentials and
+// returns the temporary credentials of the role
+func (c *Client) AssumeRole(ctx context.Context, source Credentials, region string, input AssumeRoleInput) (Credentials, error) {
+	endpoint := c.STSEndpoint
+	if endpoint == "" {
+		endpoint = regionalEndpoint("sts", region)
+	}
+	sessionName := input.SessionName
+	if sessionName == "" {
+		sessionName = DefaultRoleSessionName
+	}
+
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", "2011-06-15")
+	form.Set("RoleArn", input.RoleARN)
+	form.Set("RoleSessionName", sessionName)
+	if input.ExternalID != "" {
+		form.Set("ExternalId", input.ExternalID)
+	}
+	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8"}
+	data, err := c.do(ctx, endpoint, "sts", region, source, headers, []byte(form.Encode()), decodeXMLError)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to assume role %s: %w", input.RoleARN, err)
+	}
+
+	var response struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleResult>Credentials"`
+	}
+	if err := xml.Unmarshal(data, &response); err != nil {
+		return Credentials{}, fmt.Errorf("failed to parse the STS response: %w", err)
+	}
+	if response.Credentials.AccessKeyID == "" {
+		return Credentials{}, fmt.Errorf("failed to assume role %s: STS returned no credentials", input.RoleARN)
+	}
+	return Credentials{
+		AccessKeyID:     response.Credentials.AccessKeyID,
+		SecretAccessKey: response.Credentials.SecretAccessKey,
+		SessionToken:    response.Credentials.SessionToken,
+		Expires:         response.Credentials.Expiration,
+	}, nil
+}
+
+// decodeXMLError turns an error response of the query protocol APIs into an error
+func decodeXMLError(status int, body []byte) error {
+	var response struct {
+		Code    string `xml:"Error>Code"`
+		Message string `xml:"Error>Message"`
+	}
+	if err := xml.Unmarshal(body, &response); err != nil || response.Code == "" {
+		return fmt.Errorf("HTTP %d: %s", status, strings.TrimSpace(string(body)))
+	}
+	return fmt.Errorf("%s: %s", response.Code, response.Message)
+}
@@ -0,0 +1,97 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const assumeRoleResponse = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIA%s</AccessKeyId>
+      <SecretAccessKey>secret-%s</SecretAccessKey>
+      <SessionToken>token-%s</SessionToken>
+      <Expiration>2030-01-02T03:04:05Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/role/session</Arn>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`
+
+// stsCall is an AssumeRole call received by the stand-in
+type stsCall struct {
+	accessKeyID string
+	form        map[string]string
+}
+
+// stsStandIn answers AssumeRole with credentials named after the last segment of
+// the role ARN, and records the calls
+func stsStandIn(t *testing.T) (*Client, *[]stsCall) {
+	t.Helper()
+	var calls []stsCall
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		call := stsCall{form: map[string]string{}}
+		for key := range r.PostForm {
+			call.form[key] = r.PostForm.Get(key)
+		}
+		_, credential, _ := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+		call.accessKeyID, _, _ = strings.Cut(credential, "/")
+		calls = append(calls, call)
+
+		roleARN := r.PostForm.Get("RoleArn")
+		if strings.HasSuffix(roleARN, "/denied") {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<ErrorResponse><Error><Code>AccessDenied</Code><Message>not authorized</Message></Error></ErrorResponse>`))
+			return
+		}
+		name := roleARN[strings.LastIndex(roleARN, "/")+1:]
+		_, _ = fmt.Fprintf(w, assumeRoleResponse, name, name, name)
+	}))
+	t.Cleanup(server.Close)
+	return &Client{STSEndpoint: server.URL}, &calls
+}
+
+func TestAssumeRole(t *testing.T) {
+	client, calls := stsStandIn(t)
+	creds, err := client.AssumeRole(context.Background(), testCreds, "eu-west-1", AssumeRoleInput{
+		RoleARN:    "arn:aws:iam::123456789012:role/pull",
+		ExternalID: "external",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Credentials{
+		AccessKeyID:     "ASIApull",
+		SecretAccessKey: "secret-pull",
+		SessionToken:    "token-pull",
+		Expires:         time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if creds != want {
+		t.Errorf("got %+v, want %+v", creds, want)
+	}
+
+	form := (*calls)[0].form
+	if form["Action"] != "AssumeRole" || form["RoleSessionName"] != DefaultRoleSessionName || form["ExternalId"] != "external" {
+		t.Errorf("unexpected request %v", form)
+	}
+	if (*calls)[0].accessKeyID != testCreds.AccessKeyID {
+		t.Errorf("request signed with %s", (*calls)[0].accessKeyID)
+	}
+}
+
+func TestAssumeRoleError(t *testing.T) {
+	client, _ := stsStandIn(t)
+	_, err := client.AssumeRole(context.Background(), testCreds, "eu-west-1", AssumeRoleInput{RoleARN: "arn:aws:iam::123456789012:role/denied"})
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied: not authorized") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+// Package credhelper implements the Docker credential helper protocol on top of
+// the auth-refresher configuration, so tokens are minted when Docker asks for them.
+package credhelper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/user-cube/auth-refresher/pkg/auth"
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// ErrCredentialsNotFound is the message Docker expects when a helper has no credential for a server
+var ErrCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// Credentials is the payload exchanged with Docker on `get` and `store`
+type Credentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// Serve runs a single credential helper action, reading the request from in and
+// writing the response to out
+func Serve(ctx context.Context, configPath, action string, in io.Reader, out io.Writer) error {
+	switch action {
+	case "get":
+		return get(ctx, configPath, in, out)
+	case "store":
+		return store(ctx, configPath, in)
+	case "erase":
+		return erase(ctx, configPath, in)
+	case "list":
+		return list(configPath, out)
+	default:
+		return fmt.Errorf("unknown credential helper action: %s", action)
+	}
+}
+
+// get mints a credential for the requested server with the provider of the matching registry
+func get(ctx context.Context, configPath string, in io.Reader, out io.Writer) error {
+	serverURL, err := readServerURL(in)
+	if err != nil {
+		return err
+	}
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	_, registry, found := findRegistry(config, serverURL)
+	if !found {
+		return ErrCredentialsNotFound
+	}
+	provider, _ := auth.GetProvider(registry.Type)
+	username, password, err := provider.(auth.DockerCredentialProvider).DockerCredential(ctx, registry)
+	if errors.Is(err, auth.ErrNoCredential) {
+		return ErrCredentialsNotFound // Docker falls back to anonymous access
+	}
+	if err != nil {
+		return err // Already names the registry
+	}
+	defer password.Zero()
+
+	response, err := json.Marshal(Credentials{
+		ServerURL: serverURL,
+		Username:  username,
+		Secret:    password.Reveal(),
+	})
+	if err != nil {
+		return err
+	}
+	defer clear(response)
+	_, err = out.Write(append(response, '\n'))
+	return err
+}
+
+// store keeps the username of docker registries and remembers their password in
+// the keyring, or the secret store, never in the config file. Token based
+// registries are minted on demand so the stored value is ignored.
+func store(ctx context.Context, configPath string, in io.Reader) error {
+	var credentials Credentials
+	if err := json.NewDecoder(in).Decode(&credentials); err != nil {
+		return fmt.Errorf("failed to decode credentials: %w", err)
+	}
+	password := secret.FromString(credentials.Secret)
+	defer password.Zero()
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	key, registry, found := findRegistry(config, credentials.ServerURL)
+	if !found {
+		return fmt.Errorf("registry %s is not managed by auth-refresher, add it with `auth-refresher add` first", credentials.ServerURL)
+	}
+	if registry.Type != "docker" {
+		return nil
+	}
+	if !remembered(registry) {
+		return fmt.Errorf("registry '%s' reads its password from %s, which the credential helper does not replace", key, registry.PasswordFrom)
+	}
+	passwordFrom, err := auth.RememberPassword(ctx, key, password)
+	if err != nil {
+		return fmt.Errorf("failed to remember the password of registry '%s': %w", key, err)
+	}
+	return auth.UpdateConfig(ctx, configPath, func(config *auth.Config) error {
+		registry, exists := config.Registries[key]
+		if !exists {
+			return nil
+		}
+		registry.Username = credentials.Username
+		registry.Password = ""
+		registry.PasswordFrom = passwordFrom
+		config.Registries[key] = registry
+		return nil
+	})
+}
+
+// remembered reports whether the password of the registry is configured, or
+// remembered by auth-refresher, rather than read from a source of the user
+func remembered(registry auth.Registry) bool {
+	scheme, _, _ := strings.Cut(registry.PasswordFrom, ":")
+	return registry.PasswordFrom == "" || scheme == "keyring" || scheme == "store"
+}
+
+// erase forgets the password of docker registries, whether configured or
+// remembered in the keyring or the secret store
+func erase(ctx context.Context, configPath string, in io.Reader) error {
+	serverURL, err := readServerURL(in)
+	if err != nil {
+		return err
+	}
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	key, registry, found := findRegistry(config, serverURL)
+	if !found || registry.Type != "docker" {
+		return nil
+	}
+	if registry.PasswordFrom != "" && remembered(registry) {
+		return auth.ForgetPassword(ctx, configPath, key)
+	}
+	if registry.Password == "" {
+		return nil
+	}
+	return auth.UpdateConfig(ctx, configPath, func(config *auth.Config) error {
+		registry, exists := config.Registries[key]
+		if !exists {
+			return nil
+		}
+		registry.Password = ""
+		config.Registries[key] = registry
+		return nil
+	})
+}
+
+// list returns the servers auth-refresher can provide credentials for, with their usernames
+func list(configPath string, out io.Writer) error {
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	servers := map[string]string{}
+	for _, key := range sortedKeys(config) {
+		registry := config.Registries[key]
+		if !providesDockerCredentials(registry) {
+			continue
+		}
+		provider, _ := auth.GetProvider(registry.Type)
+		servers[auth.DockerServerKey(registry.ServerURL())] = provider.Username(registry)
+	}
+	return json.NewEncoder(out).Encode(servers)
+}
+
+// findRegistry returns the first registry, by key order, able to provide a credential for the server
+func findRegistry(config *auth.Config, serverURL string) (string, auth.Registry, bool) {
+	server := auth.DockerServerKey(serverURL)
+	for _, key := range sortedKeys(config) {
+		registry := config.Registries[key]
+		if providesDockerCredentials(registry) && auth.DockerServerKey(registry.ServerURL()) == server {
+			return key, registry, true
+		}
+	}
+	return "", auth.Registry{}, false
+}
+
+// providesDockerCredentials reports whether the registry type can mint Docker credentials
+func providesDockerCredentials(registry auth.Registry) bool {
+	provider, err := auth.GetProvider(registry.Type)
+	if err != nil {
+		return false
+	}
+	_, ok := provider.(auth.DockerCredentialProvider)
+	return ok
+}
+
+func sortedKeys(config *auth.Config) []string {
+	keys := make([]string, 0, len(config.Registries))
+	for key := range config.Registries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readServerURL reads the server URL Docker sends on stdin for `get` and `erase`
+func readServerURL(in io.Reader) (string, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return "", fmt.Errorf("failed to read server URL: %w", err)
+	}
+	serverURL := strings.TrimSpace(string(data))
+	if serverURL == "" {
+		return "", errors.New("no server URL given")
+	}
+	return serverURL, nil
+}
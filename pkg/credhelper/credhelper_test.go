@@ -0,0 +1,217 @@
+package credhelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user-cube/auth-refresher/pkg/auth"
+)
+
+const testConfig = `version: 2
+registries:
+  hub:
+    name: hub
+    type: docker
+    url: registry.example.com
+    username: me
+    password: hunter2
+  anonymous:
+    name: anonymous
+    type: docker
+    url: anonymous.example.com
+  sourced:
+    name: sourced
+    type: docker
+    url: sourced.example.com
+    username: me
+    password_from: env:SOURCED_PASSWORD
+  ecr:
+    name: ecr
+    type: aws
+    url: 123456789012.dkr.ecr.us-west-2.amazonaws.com
+    region: us-west-2
+  gar:
+    name: gar
+    type: gcp
+    url: europe-west1-docker.pkg.dev
+    token_source: key
+`
+
+// testConfigPath writes the test configuration in a temporary home, with the
+// passwords remembered in the secret store of that home
+func testConfigPath(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	t.Setenv(auth.SecretStoreEnvVar, filepath.Join(home, "secrets.enc"))
+	t.Setenv(auth.KeyringEnvVar, "file")
+	t.Setenv(auth.PassphraseEnvVar, "correct horse")
+	t.Setenv("SOURCED_PASSWORD", "from the environment")
+	path := filepath.Join(home, "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// step is one call of the credential helper
+type step struct {
+	action  string
+	input   string
+	want    string // Expected output, ignored when empty
+	wantErr string // Expected error message, empty when none
+}
+
+func TestServe(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+		check func(t *testing.T, config *auth.Config)
+	}{
+		{
+			name: "get",
+			steps: []step{{action: "get", input: "registry.example.com\n",
+				want: `{"ServerURL":"registry.example.com","Username":"me","Secret":"hunter2"}` + "\n"}},
+		},
+		{
+			name: "get with scheme and path",
+			steps: []step{{action: "get", input: "https://registry.example.com/v2/",
+				want: `{"ServerURL":"https://registry.example.com/v2/","Username":"me","Secret":"hunter2"}` + "\n"}},
+		},
+		{
+			name:  "get of an unknown server",
+			steps: []step{{action: "get", input: "unknown.example.com\n", wantErr: ErrCredentialsNotFound.Error()}},
+		},
+		{
+			name:  "get without credential",
+			steps: []step{{action: "get", input: "anonymous.example.com\n", wantErr: ErrCredentialsNotFound.Error()}},
+		},
+		{
+			name:  "get without server",
+			steps: []step{{action: "get", input: "\n", wantErr: "no server URL given"}},
+		},
+		{
+			name: "list",
+			steps: []step{{action: "list", want: `{"123456789012.dkr.ecr.us-west-2.amazonaws.com":"AWS",` +
+				`"anonymous.example.com":"","europe-west1-docker.pkg.dev":"oauth2accesstoken",` +
+				`"registry.example.com":"me","sourced.example.com":"me"}` + "\n"}},
+		},
+		{
+			name: "store",
+			steps: []step{
+				{action: "store", input: `{"ServerURL":"registry.example.com","Username":"you","Secret":"s3cret"}`},
+				{action: "get", input: "registry.example.com",
+					want: `{"ServerURL":"registry.example.com","Username":"you","Secret":"s3cret"}` + "\n"},
+			},
+			check: func(t *testing.T, config *auth.Config) {
+				if hub := config.Registries["hub"]; hub.Password != "" || hub.PasswordFrom != "store:hub" {
+					t.Errorf("got password %q from %q, want it in the secret store", hub.Password, hub.PasswordFrom)
+				}
+			},
+		},
+		{
+			name: "store of a token based registry",
+			steps: []step{
+				{action: "store", input: `{"ServerURL":"europe-west1-docker.pkg.dev","Username":"you","Secret":"s3cret"}`},
+			},
+			check: func(t *testing.T, config *auth.Config) {
+				if gar := config.Registries["gar"]; gar.Username != "" || gar.PasswordFrom != "" {
+					t.Errorf("the token based registry was changed: %+v", gar)
+				}
+			},
+		},
+		{
+			name: "store of a password read from a source",
+			steps: []step{{action: "store", input: `{"ServerURL":"sourced.example.com","Username":"you","Secret":"s3cret"}`,
+				wantErr: "registry 'sourced' reads its password from env:SOURCED_PASSWORD, which the credential helper does not replace"}},
+		},
+		{
+			name: "store of an unknown server",
+			steps: []step{{action: "store", input: `{"ServerURL":"unknown.example.com","Username":"you","Secret":"s3cret"}`,
+				wantErr: "registry unknown.example.com is not managed by auth-refresher, add it with `auth-refresher add` first"}},
+		},
+		{
+			name: "erase",
+			steps: []step{
+				{action: "erase", input: "registry.example.com"},
+				{action: "get", input: "registry.example.com", wantErr: ErrCredentialsNotFound.Error()},
+			},
+			check: func(t *testing.T, config *auth.Config) {
+				if hub := config.Registries["hub"]; hub.Password != "" || hub.Username != "me" {
+					t.Errorf("got %+v, want only the password erased", hub)
+				}
+			},
+		},
+		{
+			name: "erase of a stored password",
+			steps: []step{
+				{action: "store", input: `{"ServerURL":"registry.example.com","Username":"you","Secret":"s3cret"}`},
+				{action: "erase", input: "registry.example.com"},
+				{action: "get", input: "registry.example.com", wantErr: ErrCredentialsNotFound.Error()},
+			},
+			check: func(t *testing.T, config *auth.Config) {
+				if hub := config.Registries["hub"]; hub.PasswordFrom != "" {
+					t.Errorf("got password_from %q, want it forgotten", hub.PasswordFrom)
+				}
+				names, err := auth.StoredSecretNames(context.Background())
+				if err != nil || len(names) != 0 {
+					t.Errorf("got stored secrets %v (%v), want none", names, err)
+				}
+			},
+		},
+		{
+			name:  "erase of an unknown server",
+			steps: []step{{action: "erase", input: "unknown.example.com"}},
+		},
+		{
+			name:  "unknown action",
+			steps: []step{{action: "wipe", wantErr: "unknown credential helper action: wipe"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := testConfigPath(t)
+			for _, step := range tt.steps {
+				var out bytes.Buffer
+				err := Serve(context.Background(), configPath, step.action, strings.NewReader(step.input), &out)
+				if step.wantErr == "" && err != nil {
+					t.Fatalf("%s %q: %v", step.action, step.input, err)
+				}
+				if step.wantErr != "" && (err == nil || err.Error() != step.wantErr) {
+					t.Fatalf("%s %q: got error %v, want %q", step.action, step.input, err, step.wantErr)
+				}
+				if step.want != "" && out.String() != step.want {
+					t.Errorf("%s %q: got %s, want %s", step.action, step.input, out.String(), step.want)
+				}
+			}
+			if tt.check != nil {
+				config, err := auth.LoadConfig(configPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tt.check(t, config)
+			}
+		})
+	}
+}
+
+// Errors of the registry are passed on with the name of the registry once
+func TestGetErrorNamesRegistryOnce(t *testing.T) {
+	configPath := testConfigPath(t)
+	if err := os.Unsetenv("SOURCED_PASSWORD"); err != nil {
+		t.Fatal(err)
+	}
+	err := Serve(context.Background(), configPath, "get", strings.NewReader("sourced.example.com"), &bytes.Buffer{})
+	if err == nil || errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("got %v, want the error reading the password", err)
+	}
+	if count := strings.Count(err.Error(), "registry 'sourced'"); count != 1 {
+		t.Errorf("got %q, naming the registry %d times", err, count)
+	}
+}
@@ -0,0 +1,159 @@
+// Package gcp implements the small part of the Google Cloud authentication
+// auth-refresher needs to log into Artifact Registry and Container Registry:
+// OAuth2 access tokens from service account keys (JWT bearer exchange) and from
+// the metadata server of Google Cloud machines, and the expiry of tokens minted
+// elsewhere, such as by gcloud.
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// requestTimeout bounds every call to a Google endpoint
+const requestTimeout = 30 * time.Second
+
+// Default endpoints
+const (
+	defaultTokenEndpoint     = "https://oauth2.googleapis.com/token"
+	defaultTokenInfoEndpoint = "https://oauth2.googleapis.com/tokeninfo"
+	defaultMetadataHost      = "metadata.google.internal"
+)
+
+// Scope is the OAuth2 scope requested for the tokens, which covers Artifact
+// Registry and Container Registry
+const Scope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Client calls the Google authentication endpoints. The endpoints default to
+// the public ones and can be pointed at a local stand-in, e.g. for testing.
+type Client struct {
+	HTTPClient        *http.Client
+	TokenEndpoint     string // Replaces the token_uri of service account keys when set
+	TokenInfoEndpoint string // Base URL of the token info endpoint, empty for the public one
+	MetadataHost      string // Host of the metadata server, empty for metadata.google.internal
+}
+
+// NewClient returns a client honouring the GCE_METADATA_HOST override of the
+// Google Cloud client libraries
+func NewClient() *Client {
+	return &Client{
+		HTTPClient:   &http.Client{Timeout: requestTimeout},
+		MetadataHost: os.Getenv("GCE_METADATA_HOST"),
+	}
+}
+
+// Token is an OAuth2 access token
+type Token struct {
+	AccessToken *secret.Secret
+	ExpiresAt   time.Time
+}
+
+// tokenResponse is the response of the token endpoint and the metadata server
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"` // Seconds
+	TokenType   string `json:"token_type"`
+}
+
+// token converts the response, counting the lifetime from the time the request was sent
+func (r tokenResponse) token(requestedAt time.Time) (Token, error) {
+	if r.AccessToken == "" {
+		return Token{}, fmt.Errorf("no access token in the response")
+	}
+	if r.ExpiresIn <= 0 {
+		return Token{}, fmt.Errorf("no token lifetime in the response")
+	}
+	return Token{
+		AccessToken: secret.FromString(r.AccessToken),
+		ExpiresAt:   requestedAt.Add(time.Duration(r.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// TokenExpiry asks the token info endpoint when an access token expires, for
+// tokens minted by another program such as gcloud
+func (c *Client) TokenExpiry(ctx context.Context, token *secret.Secret) (time.Time, error) {
+	endpoint := c.TokenInfoEndpoint
+	if endpoint == "" {
+		endpoint = defaultTokenInfoEndpoint
+	}
+	// The token goes in the body rather than the query string, so it is not logged by proxies
+	form := url.Values{"access_token": {token.Reveal()}}
+	data, err := c.post(ctx, endpoint, form)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("token info request failed: %w", err)
+	}
+
+	var response struct {
+		Exp string `json:"exp"` // Seconds since the epoch
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse the token info response: %w", err)
+	}
+	seconds, err := strconv.ParseInt(response.Exp, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("token info response has an invalid expiry '%s'", response.Exp)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// post sends a form to an endpoint and returns the response body
+func (c *Client) post(ctx context.Context, endpoint string, form url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req)
+}
+
+// do sends a request and returns the response body. Responses outside of the
+// 2xx range are returned as an error by decodeError.
+func (c *Client) do(req *http.Request) (_ []byte, err error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, decodeError(resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// decodeError turns an OAuth2 error response into an error
+func decodeError(status int, body []byte) error {
+	var response struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.Error == "" {
+		return fmt.Errorf("HTTP %d: %s", status, strings.TrimSpace(string(body)))
+	}
+	if response.Description == "" {
+		return fmt.Errorf("%s", response.Error)
+	}
+	return fmt.Errorf("%s: %s", response.Error, response.Description)
+}
@@ -0,0 +1,46 @@
+package gcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+func TestTokenExpiry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "" {
+			t.Errorf("the token was sent in the query string %q", r.URL.RawQuery)
+		}
+		switch r.FormValue("access_token") {
+		case "ya29.valid":
+			_, _ = w.Write([]byte(`{"exp":"1700000000","scope":"` + Scope + `"}`))
+		case "ya29.odd":
+			_, _ = w.Write([]byte(`{"exp":"soon"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_token","error_description":"Invalid Value"}`))
+		}
+	}))
+	defer server.Close()
+	client := &Client{TokenInfoEndpoint: server.URL}
+	ctx := context.Background()
+
+	expiresAt, err := client.TokenExpiry(ctx, secret.FromString("ya29.valid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("got expiry %s", expiresAt)
+	}
+	if _, err := client.TokenExpiry(ctx, secret.FromString("ya29.odd")); err == nil || !strings.Contains(err.Error(), "invalid expiry 'soon'") {
+		t.Errorf("got %v, want an invalid expiry error", err)
+	}
+	if _, err := client.TokenExpiry(ctx, secret.FromString("ya29.expired")); err == nil || !strings.Contains(err.Error(), "invalid_token: Invalid Value") {
+		t.Errorf("got %v, want invalid_token", err)
+	}
+}
@@ -0,0 +1,51 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// metadataTimeout bounds the calls to the metadata server, which is only
+// reachable from Google Cloud machines and should answer right away
+const metadataTimeout = 5 * time.Second
+
+// MetadataToken returns an access token of a service account attached to the
+// machine, from the metadata server of Compute Engine, GKE, Cloud Run and
+// Cloud Build. An empty account means the default service account.
+func (c *Client) MetadataToken(ctx context.Context, account string) (Token, error) {
+	host := c.MetadataHost
+	if host == "" {
+		host = defaultMetadataHost
+	}
+	if account == "" {
+		account = "default"
+	}
+	endpoint := fmt.Sprintf("http://%s/computeMetadata/v1/instance/service-accounts/%s/token", host, url.PathEscape(account))
+
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	now := time.Now()
+	data, err := c.do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("metadata server token request failed (not running on Google Cloud?): %w", err)
+	}
+	var response tokenResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return Token{}, fmt.Errorf("failed to parse the metadata server response: %w", err)
+	}
+	token, err := response.token(now)
+	if err != nil {
+		return Token{}, fmt.Errorf("metadata server token request failed: %w", err)
+	}
+	return token, nil
+}
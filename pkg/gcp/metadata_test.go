@@ -0,0 +1,62 @@
+package gcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// metadataStandIn serves tokens like the metadata server and returns its host
+func metadataStandIn(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		account, found := strings.CutPrefix(r.URL.EscapedPath(), "/computeMetadata/v1/instance/service-accounts/")
+		account, _ = strings.CutSuffix(account, "/token")
+		if !found || account == "missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"ya29.` + account + `","expires_in":1800,"token_type":"Bearer"}`))
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestMetadataToken(t *testing.T) {
+	client := &Client{MetadataHost: metadataStandIn(t)}
+	tests := map[string]string{
+		"": "ya29.default",
+		"builder@project.iam.gserviceaccount.com": "ya29.builder@project.iam.gserviceaccount.com",
+	}
+	for account, want := range tests {
+		before := time.Now()
+		token, err := client.MetadataToken(context.Background(), account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken.Reveal() != want {
+			t.Errorf("account %q: got token %q, want %q", account, token.AccessToken.Reveal(), want)
+		}
+		if lifetime := token.ExpiresAt.Sub(before); lifetime < 1800*time.Second || lifetime > 1801*time.Second {
+			t.Errorf("got a lifetime of %s, want 1800s", lifetime)
+		}
+	}
+
+	if _, err := client.MetadataToken(context.Background(), "missing"); err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Errorf("got %v, want an HTTP 404 error", err)
+	}
+}
+
+func TestNewClientMetadataHost(t *testing.T) {
+	t.Setenv("GCE_METADATA_HOST", "169.254.169.254:8080")
+	if host := NewClient().MetadataHost; host != "169.254.169.254:8080" {
+		t.Errorf("got metadata host %q", host)
+	}
+}
@@ -0,0 +1,140 @@
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+// jwtBearerGrant is the OAuth2 grant type exchanging a signed JWT for an access token
+const jwtBearerGrant = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// assertionLifetime is how long the signed JWT is valid, the longest Google accepts
+const assertionLifetime = time.Hour
+
+// ServiceAccountKey is the JSON key file of a service account
+type ServiceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"` // PEM encoded RSA key
+	TokenURI     string `json:"token_uri"`
+}
+
+// ReadServiceAccountKey reads and checks a service account key file
+func ReadServiceAccountKey(path string) (*ServiceAccountKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account key: %w", err)
+	}
+	defer clear(data)
+
+	var key ServiceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse the service account key %s: %w", path, err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("%s is not a service account key (type '%s')", path, key.Type)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("service account key %s has no client_email or private_key", path)
+	}
+	return &key, nil
+}
+
+// ServiceAccountToken exchanges a JWT signed with the service account key for
+// an access token, as described in RFC 7523
+func (c *Client) ServiceAccountToken(ctx context.Context, key *ServiceAccountKey) (Token, error) {
+	endpoint := c.TokenEndpoint
+	if endpoint == "" {
+		endpoint = key.TokenURI
+	}
+	if endpoint == "" {
+		endpoint = defaultTokenEndpoint
+	}
+
+	now := time.Now()
+	assertion, err := signAssertion(key, endpoint, now)
+	if err != nil {
+		return Token{}, err
+	}
+	form := url.Values{"grant_type": {jwtBearerGrant}, "assertion": {assertion}}
+	data, err := c.post(ctx, endpoint, form)
+	if err != nil {
+		return Token{}, fmt.Errorf("token exchange for %s failed: %w", key.ClientEmail, err)
+	}
+
+	var response tokenResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return Token{}, fmt.Errorf("failed to parse the token response: %w", err)
+	}
+	token, err := response.token(now)
+	if err != nil {
+		return Token{}, fmt.Errorf("token exchange for %s failed: %w", key.ClientEmail, err)
+	}
+	return token, nil
+}
+
+// signAssertion builds the JWT asserting the identity of the service account,
+// signed with RS256 and addressed to the token endpoint
+func signAssertion(key *ServiceAccountKey, audience string, now time.Time) (string, error) {
+	privateKey, err := parsePrivateKey(key.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("service account key of %s: %w", key.ClientEmail, err)
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": key.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   key.ClientEmail,
+		"scope": Scope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(assertionLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign the token request: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey decodes a PEM encoded RSA key, in PKCS #8 as Google issues
+// them or in PKCS #1
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("private_key is not PEM encoded")
+	}
+	defer clear(block.Bytes)
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private_key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private_key is not an RSA key")
+	}
+	return key, nil
+}
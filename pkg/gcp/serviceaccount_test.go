@@ -0,0 +1,189 @@
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testClientEmail = "builder@project.iam.gserviceaccount.com"
+
+// testKey returns a service account key holding a fresh RSA key, along with
+// its public half
+func testKey(t *testing.T, tokenURI string) (*ServiceAccountKey, *rsa.PublicKey) {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ServiceAccountKey{
+		Type:         "service_account",
+		ClientEmail:  testClientEmail,
+		PrivateKeyID: "key-1",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:     tokenURI,
+	}, &privateKey.PublicKey
+}
+
+// verifyAssertion checks the RS256 signature of a JWT and returns its header and claims
+func verifyAssertion(assertion string, publicKey *rsa.PublicKey) (header map[string]string, claims map[string]any, err error) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("assertion has %d parts", len(parts))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, nil, fmt.Errorf("invalid assertion signature: %w", err)
+	}
+	for i, v := range []any{&header, &claims} {
+		data, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			return nil, nil, err
+		}
+	}
+	return header, claims, nil
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	var publicKey *rsa.PublicKey
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if grant := r.PostForm.Get("grant_type"); grant != jwtBearerGrant {
+			t.Errorf("got grant_type %s", grant)
+		}
+		header, claims, err := verifyAssertion(r.PostForm.Get("assertion"), publicKey)
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if header["alg"] != "RS256" || header["kid"] != "key-1" {
+			t.Errorf("unexpected header %v", header)
+		}
+		if claims["iss"] != testClientEmail || claims["scope"] != Scope || claims["aud"] != "http://"+r.Host+"/token" {
+			t.Errorf("unexpected claims %v", claims)
+		}
+		iat, _ := claims["iat"].(float64)
+		exp, _ := claims["exp"].(float64)
+		if time.Duration(exp-iat)*time.Second != assertionLifetime || time.Since(time.Unix(int64(iat), 0)).Abs() > time.Minute {
+			t.Errorf("unexpected iat %v and exp %v", iat, exp)
+		}
+		_, _ = w.Write([]byte(`{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`))
+	}))
+	defer server.Close()
+
+	key, public := testKey(t, server.URL+"/token")
+	publicKey = public
+	before := time.Now()
+	token, err := NewClient().ServiceAccountToken(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken.Reveal() != "ya29.token" {
+		t.Errorf("got token %q", token.AccessToken.Reveal())
+	}
+	if lifetime := token.ExpiresAt.Sub(before); lifetime < 3599*time.Second || lifetime > 3600*time.Second {
+		t.Errorf("got a lifetime of %s, want 3599s", lifetime)
+	}
+}
+
+func TestServiceAccountTokenErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"oauth error", http.StatusBadRequest, `{"error":"invalid_grant","error_description":"Invalid JWT Signature."}`, "invalid_grant: Invalid JWT Signature."},
+		{"oauth error without description", http.StatusUnauthorized, `{"error":"unauthorized_client"}`, "unauthorized_client"},
+		{"not JSON", http.StatusBadGateway, "upstream unavailable\n", "HTTP 502: upstream unavailable"},
+		{"no token", http.StatusOK, `{"expires_in":3599}`, "no access token in the response"},
+		{"no lifetime", http.StatusOK, `{"access_token":"ya29.token"}`, "no token lifetime in the response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			key, _ := testKey(t, "https://oauth2.example.com/token")
+			client := &Client{TokenEndpoint: server.URL}
+			_, err := client.ServiceAccountToken(context.Background(), key)
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("got %v, want an error containing %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestReadServiceAccountKey(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]struct {
+		content string
+		message string
+	}{
+		"valid":          {content: `{"type":"service_account","client_email":"a@b","private_key":"pem"}`},
+		"not JSON":       {content: "key", message: "failed to parse"},
+		"not a service":  {content: `{"type":"authorized_user"}`, message: "is not a service account key (type 'authorized_user')"},
+		"no private key": {content: `{"type":"service_account","client_email":"a@b"}`, message: "has no client_email or private_key"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			key, err := ReadServiceAccountKey(path)
+			if tt.message == "" {
+				if err != nil || key.ClientEmail != "a@b" {
+					t.Errorf("got %v, %v", key, err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("got %v, want an error containing %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	if parsed, err := parsePrivateKey(string(pkcs1)); err != nil || !parsed.Equal(privateKey) {
+		t.Errorf("PKCS #1 key: got %v", err)
+	}
+	if _, err := parsePrivateKey("not a key"); err == nil {
+		t.Error("expected an error for a key that is not PEM encoded")
+	}
+}
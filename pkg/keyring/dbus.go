@@ -0,0 +1,363 @@
+package keyring
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// D-Bus message types
+const (
+	messageMethodCall   = 1
+	messageMethodReturn = 2
+	messageError        = 3
+	messageSignal       = 4
+)
+
+// D-Bus header field codes
+const (
+	fieldPath        = 1
+	fieldInterface   = 2
+	fieldMember      = 3
+	fieldErrorName   = 4
+	fieldReplySerial = 5
+	fieldDestination = 6
+	fieldSender      = 7
+	fieldSignature   = 8
+)
+
+// maxMessageSize is the largest message accepted from the bus, as in the specification
+const maxMessageSize = 128 << 20
+
+// message is a D-Bus message
+type message struct {
+	Type        byte
+	Serial      uint32
+	Path        ObjectPath
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Sender      string
+	Signature   string
+	Body        []any
+}
+
+// DBusError is an error reply of a D-Bus method call
+type DBusError struct {
+	Name    string
+	Message string
+}
+
+func (e *DBusError) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Message
+}
+
+// conn is a connection to a message bus
+type conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	serial  uint32
+	pending []*message // Signals received while waiting for a reply
+	stop    func() bool
+}
+
+// SessionBusAddress returns the address of the session bus, from
+// DBUS_SESSION_BUS_ADDRESS or the systemd user bus socket
+func SessionBusAddress() string {
+	if address := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); address != "" {
+		return address
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		path := filepath.Join(dir, "bus")
+		if _, err := os.Stat(path); err == nil {
+			return "unix:path=" + path
+		}
+	}
+	return ""
+}
+
+// dial connects and authenticates to the bus at address, trying every address of
+// the list in turn. The connection is closed when ctx is done.
+func dial(ctx context.Context, address string) (*conn, error) {
+	if address == "" {
+		return nil, fmt.Errorf("no D-Bus session bus address")
+	}
+	var errs []error
+	for _, entry := range strings.Split(address, ";") {
+		netConn, err := dialAddress(ctx, entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c := &conn{conn: netConn, reader: bufio.NewReader(netConn)}
+		c.stop = context.AfterFunc(ctx, func() { _ = netConn.Close() })
+		if err := c.authenticate(); err != nil {
+			c.Close()
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := c.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", ""); err != nil {
+			c.Close()
+			errs = append(errs, err)
+			continue
+		}
+		return c, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// dialAddress opens the socket of a single unix transport address
+func dialAddress(ctx context.Context, address string) (net.Conn, error) {
+	transport, params, _ := strings.Cut(address, ":")
+	if transport != "unix" {
+		return nil, fmt.Errorf("unsupported D-Bus transport '%s'", transport)
+	}
+	var path string
+	for _, param := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(param, "=")
+		value, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid D-Bus address '%s': %w", address, err)
+		}
+		switch key {
+		case "path":
+			path = value
+		case "abstract":
+			path = "@" + value
+		}
+	}
+	if path == "" {
+		return nil, fmt.Errorf("unsupported D-Bus address '%s'", address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unix", path)
+}
+
+// authenticate runs the EXTERNAL authentication, the bus checking the uid of
+// the socket peer
+func (c *conn) authenticate() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := io.WriteString(c.conn, "\x00AUTH EXTERNAL "+uid+"\r\n"); err != nil {
+		return fmt.Errorf("D-Bus authentication failed: %w", err)
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("D-Bus authentication failed: %w", err)
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("D-Bus authentication rejected: %s", strings.TrimSpace(line))
+	}
+	if _, err := io.WriteString(c.conn, "BEGIN\r\n"); err != nil {
+		return fmt.Errorf("D-Bus authentication failed: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (c *conn) Close() {
+	c.stop()
+	_ = c.conn.Close()
+}
+
+// call invokes a method and returns the body of its reply. An error reply is
+// returned as a *DBusError.
+func (c *conn) call(destination string, path ObjectPath, iface, member, sig string, args ...any) ([]any, error) {
+	c.serial++
+	serial := c.serial
+	err := c.send(&message{
+		Type:        messageMethodCall,
+		Serial:      serial,
+		Path:        path,
+		Interface:   iface,
+		Member:      member,
+		Destination: destination,
+		Signature:   sig,
+		Body:        args,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		msg, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case msg.Type == messageSignal:
+			c.pending = append(c.pending, msg)
+		case msg.ReplySerial != serial:
+			continue
+		case msg.Type == messageError:
+			dbusErr := &DBusError{Name: msg.ErrorName}
+			if len(msg.Body) > 0 {
+				dbusErr.Message, _ = msg.Body[0].(string)
+			}
+			return nil, dbusErr
+		case msg.Type == messageMethodReturn:
+			return msg.Body, nil
+		}
+	}
+}
+
+// waitSignal returns the first signal of the interface and member emitted by
+// the object at path, among the queued signals first
+func (c *conn) waitSignal(path ObjectPath, iface, member string) (*message, error) {
+	matches := func(msg *message) bool {
+		return msg.Type == messageSignal && msg.Path == path && msg.Interface == iface && msg.Member == member
+	}
+	for i, msg := range c.pending {
+		if matches(msg) {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return msg, nil
+		}
+	}
+	for {
+		msg, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		if matches(msg) {
+			return msg, nil
+		}
+	}
+}
+
+// send marshals and writes a message
+func (c *conn) send(msg *message) error {
+	body := &encoder{}
+	types, err := splitSignature(msg.Signature)
+	if err != nil {
+		return err
+	}
+	if len(types) != len(msg.Body) {
+		return fmt.Errorf("D-Bus signature %s has %d types, got %d values", msg.Signature, len(types), len(msg.Body))
+	}
+	for i, value := range msg.Body {
+		if err := body.encode(types[i], value); err != nil {
+			return err
+		}
+	}
+
+	fields := []any{}
+	addField := func(code byte, sig string, value any) {
+		fields = append(fields, []any{code, Variant{Signature: sig, Value: value}})
+	}
+	if msg.Path != "" {
+		addField(fieldPath, "o", msg.Path)
+	}
+	if msg.Interface != "" {
+		addField(fieldInterface, "s", msg.Interface)
+	}
+	if msg.Member != "" {
+		addField(fieldMember, "s", msg.Member)
+	}
+	if msg.ErrorName != "" {
+		addField(fieldErrorName, "s", msg.ErrorName)
+	}
+	if msg.ReplySerial != 0 {
+		addField(fieldReplySerial, "u", msg.ReplySerial)
+	}
+	if msg.Destination != "" {
+		addField(fieldDestination, "s", msg.Destination)
+	}
+	if msg.Signature != "" {
+		addField(fieldSignature, "g", msg.Signature)
+	}
+
+	header := &encoder{buf: []byte{'l', msg.Type, 0, 1}}
+	header.uint32(uint32(len(body.buf)))
+	header.uint32(msg.Serial)
+	if err := header.encode("a(yv)", fields); err != nil {
+		return err
+	}
+	header.align(8)
+	_, err = c.conn.Write(append(header.buf, body.buf...))
+	clear(body.buf)
+	return err
+}
+
+// receive reads and unmarshals the next message
+func (c *conn) receive() (*message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, fixed); err != nil {
+		return nil, fmt.Errorf("failed to read from D-Bus: %w", err)
+	}
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid D-Bus message byte order %q", fixed[0])
+	}
+	bodyLen := int(order.Uint32(fixed[4:]))
+	fieldsLen := int(order.Uint32(fixed[12:]))
+	headerLen := 16 + fieldsLen
+	headerLen += (8 - headerLen%8) % 8
+	if headerLen+bodyLen > maxMessageSize {
+		return nil, fmt.Errorf("D-Bus message too large")
+	}
+	data := make([]byte, headerLen+bodyLen)
+	copy(data, fixed)
+	if _, err := io.ReadFull(c.reader, data[16:]); err != nil {
+		return nil, fmt.Errorf("failed to read from D-Bus: %w", err)
+	}
+
+	msg := &message{Type: fixed[1], Serial: order.Uint32(fixed[8:])}
+	header := &decoder{buf: data[:16+fieldsLen], pos: 12, order: order}
+	fields, err := header.decode("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	entries, _ := fields.([]any)
+	for _, entry := range entries {
+		field, _ := entry.([]any)
+		if len(field) != 2 {
+			return nil, fmt.Errorf("invalid D-Bus header field")
+		}
+		code, _ := field[0].(byte)
+		variant, _ := field[1].(Variant)
+		value := variant.Value
+		switch code {
+		case fieldPath:
+			msg.Path, _ = value.(ObjectPath)
+		case fieldInterface:
+			msg.Interface, _ = value.(string)
+		case fieldMember:
+			msg.Member, _ = value.(string)
+		case fieldErrorName:
+			msg.ErrorName, _ = value.(string)
+		case fieldReplySerial:
+			msg.ReplySerial, _ = value.(uint32)
+		case fieldDestination:
+			msg.Destination, _ = value.(string)
+		case fieldSender:
+			msg.Sender, _ = value.(string)
+		case fieldSignature:
+			msg.Signature, _ = value.(string)
+		}
+	}
+
+	body := &decoder{buf: data[headerLen:], order: order}
+	if msg.Body, err = body.decodeAll(msg.Signature); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,263 @@
+// Package keyring stores secrets in the desktop keyring through the freedesktop
+// Secret Service D-Bus API, implemented by GNOME Keyring, KWallet and KeePassXC.
+// It speaks the D-Bus wire protocol itself, so no C library is needed.
+package keyring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+// Secret Service names
+const (
+	serviceName       = "org.freedesktop.secrets"
+	servicePath       = ObjectPath("/org/freedesktop/secrets")
+	serviceInterface  = "org.freedesktop.Secret.Service"
+	collectionIface   = "org.freedesktop.Secret.Collection"
+	itemInterface     = "org.freedesktop.Secret.Item"
+	promptInterface   = "org.freedesktop.Secret.Prompt"
+	defaultCollection = "default"
+	noObject          = ObjectPath("/") // Returned instead of a prompt or an item when there is none
+)
+
+// ErrNotFound is returned when no secret matches the attributes
+var ErrNotFound = errors.New("secret not found in the keyring")
+
+// ErrUnavailable is returned when no Secret Service can be reached, e.g. on a
+// headless machine without a session bus or a keyring daemon
+var ErrUnavailable = errors.New("no Secret Service keyring available")
+
+// ErrDismissed is returned when the user dismisses the unlock prompt of the keyring
+var ErrDismissed = errors.New("keyring prompt dismissed")
+
+// SecretService is a client of the Secret Service on a message bus
+type SecretService struct {
+	Address string // D-Bus address of the bus, see SessionBusAddress
+}
+
+// NewSecretService returns a client of the Secret Service on the session bus
+func NewSecretService() *SecretService {
+	return &SecretService{Address: SessionBusAddress()}
+}
+
+// session is an open Secret Service session, secrets being exchanged in plain
+// text over the local bus socket
+type session struct {
+	conn *conn
+	path ObjectPath
+}
+
+// open connects to the Secret Service and opens a session
+func (s *SecretService) open(ctx context.Context) (*session, error) {
+	c, err := dial(ctx, s.Address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	reply, err := c.call(serviceName, servicePath, serviceInterface, "OpenSession", "sv", "plain", Variant{Signature: "s", Value: ""})
+	if err != nil {
+		c.Close()
+		var dbusErr *DBusError
+		if errors.As(err, &dbusErr) && (dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown" ||
+			dbusErr.Name == "org.freedesktop.DBus.Error.NameHasNoOwner") {
+			return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return nil, fmt.Errorf("failed to open a Secret Service session: %w", err)
+	}
+	path := pathAt(reply, 1)
+	if path == noObject {
+		c.Close()
+		return nil, fmt.Errorf("unexpected OpenSession reply")
+	}
+	return &session{conn: c, path: path}, nil
+}
+
+func (s *session) close() {
+	_, _ = s.conn.call(serviceName, s.path, "org.freedesktop.Secret.Session", "Close", "")
+	s.conn.Close()
+}
+
+// Available reports whether a Secret Service can be reached
+func (s *SecretService) Available(ctx context.Context) bool {
+	sess, err := s.open(ctx)
+	if err != nil {
+		return false
+	}
+	sess.close()
+	return true
+}
+
+// Get returns the secret of the item matching the attributes
+func (s *SecretService) Get(ctx context.Context, attributes map[string]string) (*secret.Secret, error) {
+	sess, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer sess.close()
+
+	items, err := sess.search(attributes)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	reply, err := sess.conn.call(serviceName, items[0], itemInterface, "GetSecret", "o", sess.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the keyring secret: %w", err)
+	}
+	var fields []any
+	if len(reply) == 1 {
+		fields, _ = reply[0].([]any)
+	}
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("unexpected GetSecret reply")
+	}
+	value, _ := fields[2].([]byte)
+	return secret.New(value), nil
+}
+
+// Set stores the secret in the default collection under the attributes,
+// replacing the item already holding them
+func (s *SecretService) Set(ctx context.Context, label string, attributes map[string]string, value *secret.Secret) error {
+	sess, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+
+	reply, err := sess.conn.call(serviceName, servicePath, serviceInterface, "ReadAlias", "s", defaultCollection)
+	if err != nil {
+		return fmt.Errorf("failed to find the default keyring: %w", err)
+	}
+	collection := pathAt(reply, 0)
+	if collection == noObject {
+		return fmt.Errorf("the keyring has no default collection")
+	}
+	if err := sess.unlock([]ObjectPath{collection}); err != nil {
+		return err
+	}
+
+	properties := map[string]Variant{
+		"org.freedesktop.Secret.Item.Label":      {Signature: "s", Value: label},
+		"org.freedesktop.Secret.Item.Attributes": {Signature: "a{ss}", Value: attributes},
+	}
+	item := []any{sess.path, []byte{}, value.Bytes(), "text/plain"}
+	reply, err = sess.conn.call(serviceName, collection, collectionIface, "CreateItem", "a{sv}(oayays)b", properties, item, true)
+	if err != nil {
+		return fmt.Errorf("failed to store the secret in the keyring: %w", err)
+	}
+	if prompt := pathAt(reply, 1); prompt != noObject {
+		if err := sess.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes every item matching the attributes
+func (s *SecretService) Delete(ctx context.Context, attributes map[string]string) error {
+	sess, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+
+	items, err := sess.search(attributes)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return ErrNotFound
+	}
+	for _, item := range items {
+		reply, err := sess.conn.call(serviceName, item, itemInterface, "Delete", "")
+		if err != nil {
+			return fmt.Errorf("failed to delete the keyring secret: %w", err)
+		}
+		if prompt := pathAt(reply, 0); prompt != noObject {
+			if err := sess.prompt(prompt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// search returns the items matching the attributes, unlocking the locked ones
+func (s *session) search(attributes map[string]string) ([]ObjectPath, error) {
+	reply, err := s.conn.call(serviceName, servicePath, serviceInterface, "SearchItems", "a{ss}", attributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search the keyring: %w", err)
+	}
+	if len(reply) != 2 {
+		return nil, fmt.Errorf("unexpected SearchItems reply")
+	}
+	unlocked, locked := objectPaths(reply[0]), objectPaths(reply[1])
+	if len(locked) > 0 {
+		if err := s.unlock(locked); err != nil {
+			return nil, err
+		}
+	}
+	return append(unlocked, locked...), nil
+}
+
+// unlock unlocks the objects, which may show a password prompt of the keyring
+func (s *session) unlock(objects []ObjectPath) error {
+	reply, err := s.conn.call(serviceName, servicePath, serviceInterface, "Unlock", "ao", objects)
+	if err != nil {
+		return fmt.Errorf("failed to unlock the keyring: %w", err)
+	}
+	if prompt := pathAt(reply, 1); prompt != noObject {
+		if err := s.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prompt shows a prompt of the keyring and waits for its completion
+func (s *session) prompt(prompt ObjectPath) error {
+	rule := fmt.Sprintf("type='signal',interface='%s',member='Completed',path='%s'", promptInterface, prompt)
+	if _, err := s.conn.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "AddMatch", "s", rule); err != nil {
+		return fmt.Errorf("failed to watch the keyring prompt: %w", err)
+	}
+	if _, err := s.conn.call(serviceName, prompt, promptInterface, "Prompt", "s", ""); err != nil {
+		return fmt.Errorf("failed to show the keyring prompt: %w", err)
+	}
+	signal, err := s.conn.waitSignal(prompt, promptInterface, "Completed")
+	if err != nil {
+		return err
+	}
+	if len(signal.Body) == 0 {
+		return fmt.Errorf("unexpected keyring prompt result")
+	}
+	if dismissed, _ := signal.Body[0].(bool); dismissed {
+		return ErrDismissed
+	}
+	return nil
+}
+
+// pathAt returns the object path at index i of a reply, "/" when there is none
+func pathAt(reply []any, i int) ObjectPath {
+	if i < len(reply) {
+		if path, ok := reply[i].(ObjectPath); ok && path != "" {
+			return path
+		}
+	}
+	return noObject
+}
+
+// objectPaths converts a decoded `ao` value
+func objectPaths(value any) []ObjectPath {
+	values, _ := value.([]any)
+	paths := make([]ObjectPath, 0, len(values))
+	for _, v := range values {
+		if path, ok := v.(ObjectPath); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,291 @@
+package keyring
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/user-cube/auth-refresher/pkg/secret"
+)
+
+const (
+	fakeCollection = ObjectPath("/org/freedesktop/secrets/collection/login")
+	fakeSession    = ObjectPath("/org/freedesktop/secrets/session/1")
+	fakePrompt     = ObjectPath("/org/freedesktop/secrets/prompt/1")
+)
+
+type fakeItem struct {
+	attributes map[string]string
+	secret     []byte
+}
+
+// fakeService is a stand-in Secret Service, serving a minimal message bus on a
+// unix socket
+type fakeService struct {
+	mu      sync.Mutex
+	items   map[ObjectPath]fakeItem
+	created int
+	locked  bool // Unlocking needs a prompt
+	dismiss bool // Prompts are dismissed
+	absent  bool // No Secret Service owns its bus name
+	prompts int
+}
+
+// start listens on a socket of a temporary directory and returns the bus address
+func (s *fakeService) start(t *testing.T) string {
+	t.Helper()
+	s.items = map[ObjectPath]fakeItem{}
+	path := filepath.Join(t.TempDir(), "bus")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			netConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(netConn)
+		}
+	}()
+	return "unix:path=" + path
+}
+
+func (s *fakeService) serve(netConn net.Conn) {
+	defer func() { _ = netConn.Close() }()
+	reader := bufio.NewReader(netConn)
+	if nul, err := reader.ReadByte(); err != nil || nul != 0 {
+		return
+	}
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "AUTH EXTERNAL ") {
+		return
+	}
+	if _, err := io.WriteString(netConn, "OK 0123456789abcdef0123456789abcdef\r\n"); err != nil {
+		return
+	}
+	if line, err := reader.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		return
+	}
+
+	c := &conn{conn: netConn, reader: reader, stop: func() bool { return true }}
+	for {
+		msg, err := c.receive()
+		if err != nil {
+			return
+		}
+		if msg.Type == messageMethodCall {
+			s.handle(c, msg)
+		}
+	}
+}
+
+func (s *fakeService) handle(c *conn, msg *message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply := func(sig string, body ...any) {
+		c.serial++
+		_ = c.send(&message{Type: messageMethodReturn, Serial: c.serial, ReplySerial: msg.Serial, Signature: sig, Body: body})
+	}
+	fail := func(name string) {
+		c.serial++
+		_ = c.send(&message{Type: messageError, Serial: c.serial, ReplySerial: msg.Serial, ErrorName: name, Signature: "s", Body: []any{"fake"}})
+	}
+
+	if msg.Destination == serviceName && s.absent {
+		fail("org.freedesktop.DBus.Error.ServiceUnknown")
+		return
+	}
+	switch msg.Member {
+	case "Hello":
+		reply("s", ":1.42")
+	case "AddMatch", "Close":
+		reply("")
+	case "OpenSession":
+		reply("vo", Variant{Signature: "s", Value: ""}, fakeSession)
+	case "ReadAlias":
+		reply("o", fakeCollection)
+	case "Unlock":
+		if s.locked {
+			reply("aoo", []ObjectPath{}, fakePrompt)
+		} else {
+			reply("aoo", objectPaths(msg.Body[0]), noObject)
+		}
+	case "Prompt":
+		s.prompts++
+		reply("")
+		if !s.dismiss {
+			s.locked = false
+		}
+		c.serial++
+		_ = c.send(&message{Type: messageSignal, Serial: c.serial, Path: msg.Path, Interface: promptInterface, Member: "Completed",
+			Signature: "bv", Body: []any{s.dismiss, Variant{Signature: "s", Value: ""}}})
+	case "SearchItems":
+		matches := s.search(stringMap(msg.Body[0]))
+		if s.locked {
+			reply("aoao", []ObjectPath{}, matches)
+		} else {
+			reply("aoao", matches, []ObjectPath{})
+		}
+	case "GetSecret":
+		item, exists := s.items[msg.Path]
+		if !exists || s.locked {
+			fail("org.freedesktop.Secret.Error.NoSuchObject")
+			return
+		}
+		reply("(oayays)", []any{fakeSession, []byte{}, item.secret, "text/plain"})
+	case "CreateItem":
+		properties, _ := msg.Body[0].(map[string]any)
+		attributes := stringMap(properties["org.freedesktop.Secret.Item.Attributes"].(Variant).Value)
+		value := msg.Body[1].([]any)[2].([]byte)
+		for _, path := range s.search(attributes) {
+			delete(s.items, path)
+		}
+		s.created++
+		path := ObjectPath(fmt.Sprintf("%s/%d", fakeCollection, s.created))
+		s.items[path] = fakeItem{attributes: attributes, secret: value}
+		reply("oo", path, noObject)
+	case "Delete":
+		delete(s.items, msg.Path)
+		reply("o", noObject)
+	default:
+		fail("org.freedesktop.DBus.Error.UnknownMethod")
+	}
+}
+
+// counts returns the number of prompts shown and of items stored
+func (s *fakeService) counts() (prompts, items int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prompts, len(s.items)
+}
+
+// search returns the items holding every attribute
+func (s *fakeService) search(attributes map[string]string) []ObjectPath {
+	var matches []ObjectPath
+	for path, item := range s.items {
+		matched := true
+		for key, value := range attributes {
+			if item.attributes[key] != value {
+				matched = false
+			}
+		}
+		if matched {
+			matches = append(matches, path)
+		}
+	}
+	return matches
+}
+
+// stringMap converts a decoded `a{ss}` value
+func stringMap(value any) map[string]string {
+	decoded, _ := value.(map[string]any)
+	m := make(map[string]string, len(decoded))
+	for key, v := range decoded {
+		m[key], _ = v.(string)
+	}
+	return m
+}
+
+var testAttributes = map[string]string{"application": "auth-refresher", "registry": "hub"}
+
+func TestSecretServiceRoundTrip(t *testing.T) {
+	fake := &fakeService{locked: true}
+	service := &SecretService{Address: fake.start(t)}
+	ctx := context.Background()
+
+	if !service.Available(ctx) {
+		t.Fatal("expected the service to be available")
+	}
+	if err := service.Set(ctx, "auth-refresher: hub", testAttributes, secret.FromString("first")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if prompts, _ := fake.counts(); prompts != 1 {
+		t.Errorf("expected the unlock prompt once, got %d", prompts)
+	}
+	if err := service.Set(ctx, "auth-refresher: hub", testAttributes, secret.FromString("hunter2")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, items := fake.counts(); items != 1 {
+		t.Errorf("expected the item to be replaced, got %d items", items)
+	}
+
+	value, err := service.Get(ctx, testAttributes)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if value.Reveal() != "hunter2" {
+		t.Errorf("got %q, want hunter2", value.Reveal())
+	}
+
+	if err := service.Delete(ctx, testAttributes); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := service.Get(ctx, testAttributes); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	if err := service.Delete(ctx, testAttributes); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete after Delete: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestSecretServiceUnlocksLockedItems(t *testing.T) {
+	fake := &fakeService{}
+	service := &SecretService{Address: fake.start(t)}
+	ctx := context.Background()
+	if err := service.Set(ctx, "auth-refresher: hub", testAttributes, secret.FromString("hunter2")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	fake.mu.Lock()
+	fake.locked = true
+	fake.mu.Unlock()
+	value, err := service.Get(ctx, testAttributes)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if prompts, _ := fake.counts(); value.Reveal() != "hunter2" || prompts != 1 {
+		t.Errorf("got %q after %d prompts, want hunter2 after 1", value.Reveal(), prompts)
+	}
+}
+
+func TestSecretServiceDismissedPrompt(t *testing.T) {
+	fake := &fakeService{locked: true, dismiss: true}
+	service := &SecretService{Address: fake.start(t)}
+	err := service.Set(context.Background(), "auth-refresher: hub", testAttributes, secret.FromString("hunter2"))
+	if !errors.Is(err, ErrDismissed) {
+		t.Errorf("got %v, want ErrDismissed", err)
+	}
+	if _, items := fake.counts(); items != 0 {
+		t.Errorf("expected nothing stored, got %d items", items)
+	}
+}
+
+func TestSecretServiceUnavailable(t *testing.T) {
+	ctx := context.Background()
+	tests := map[string]string{
+		"no bus":     "unix:path=" + filepath.Join(t.TempDir(), "missing"),
+		"no service": (&fakeService{absent: true}).start(t),
+		"no address": "",
+	}
+	for name, address := range tests {
+		t.Run(name, func(t *testing.T) {
+			service := &SecretService{Address: address}
+			if service.Available(ctx) {
+				t.Error("expected the service to be unavailable")
+			}
+			if _, err := service.Get(ctx, testAttributes); !errors.Is(err, ErrUnavailable) {
+				t.Errorf("got %v, want ErrUnavailable", err)
+			}
+		})
+	}
+}
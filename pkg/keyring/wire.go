@@ -0,0 +1,413 @@
+package keyring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// ObjectPath is a D-Bus object path, the `o` type
+type ObjectPath string
+
+// Variant is a D-Bus variant, a value along with its signature
+type Variant struct {
+	Signature string
+	Value     any
+}
+
+// encoder marshals values in the little endian D-Bus wire format. Alignment is
+// relative to the start of buf, which must start at an 8 byte boundary of the
+// message.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(append(e.buf, s...), 0)
+}
+
+func (e *encoder) signature(s string) {
+	e.buf = append(append(append(e.buf, byte(len(s))), s...), 0)
+}
+
+// array writes the length placeholder, then the elements, then the length
+func (e *encoder) array(elemAlign int, elements func()) {
+	e.uint32(0)
+	at := len(e.buf) - 4
+	e.align(elemAlign)
+	start := len(e.buf)
+	elements()
+	binary.LittleEndian.PutUint32(e.buf[at:], uint32(len(e.buf)-start))
+}
+
+// encode marshals a value of a single complete type. Only the Go types used by
+// the Secret Service calls are supported.
+func (e *encoder) encode(sig string, value any) error {
+	switch sig[0] {
+	case 'y':
+		e.buf = append(e.buf, value.(byte))
+	case 'b':
+		var b uint32
+		if value.(bool) {
+			b = 1
+		}
+		e.uint32(b)
+	case 'u':
+		e.uint32(value.(uint32))
+	case 's':
+		e.string(value.(string))
+	case 'o':
+		e.string(string(value.(ObjectPath)))
+	case 'g':
+		e.signature(value.(string))
+	case 'v':
+		variant := value.(Variant)
+		e.signature(variant.Signature)
+		return e.encode(variant.Signature, variant.Value)
+	case '(':
+		e.align(8)
+		fields := value.([]any)
+		types, err := splitSignature(sig[1 : len(sig)-1])
+		if err != nil {
+			return err
+		}
+		if len(types) != len(fields) {
+			return fmt.Errorf("struct %s has %d fields, got %d values", sig, len(types), len(fields))
+		}
+		for i, field := range fields {
+			if err := e.encode(types[i], field); err != nil {
+				return err
+			}
+		}
+	case 'a':
+		return e.encodeArray(sig, value)
+	default:
+		return fmt.Errorf("unsupported D-Bus type %s", sig)
+	}
+	return nil
+}
+
+func (e *encoder) encodeArray(sig string, value any) error {
+	elem := sig[1:]
+	var err error
+	switch values := value.(type) {
+	case []byte:
+		e.array(1, func() { e.buf = append(e.buf, values...) })
+	case []ObjectPath:
+		e.array(4, func() {
+			for _, path := range values {
+				e.string(string(path))
+			}
+		})
+	case []any:
+		e.array(alignment(elem[0]), func() {
+			for _, v := range values {
+				if err == nil {
+					err = e.encode(elem, v)
+				}
+			}
+		})
+	case map[string]string:
+		e.array(8, func() {
+			for _, key := range sortedKeys(values) {
+				e.align(8)
+				e.string(key)
+				e.string(values[key])
+			}
+		})
+	case map[string]Variant:
+		e.array(8, func() {
+			for _, key := range sortedKeys(values) {
+				e.align(8)
+				e.string(key)
+				if err == nil {
+					err = e.encode("v", values[key])
+				}
+			}
+		})
+	default:
+		return fmt.Errorf("unsupported value %T for D-Bus type %s", value, sig)
+	}
+	return err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// maxNesting is the deepest nesting of containers the D-Bus specification
+// allows, 32 arrays and 32 structs. Variants count as well, so a message of
+// nested variants cannot exhaust the stack.
+const maxNesting = 64
+
+// decoder unmarshals values of the D-Bus wire format, in either byte order
+type decoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+	depth int // Containers being decoded
+}
+
+var errTruncated = fmt.Errorf("truncated D-Bus message")
+
+func (d *decoder) align(n int) error {
+	for d.pos%n != 0 {
+		d.pos++
+	}
+	if d.pos > len(d.buf) {
+		return errTruncated
+	}
+	return nil
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if d.pos+n > len(d.buf) {
+		return nil, errTruncated
+	}
+	data := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return data, nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+	data, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint32(data), nil
+}
+
+func (d *decoder) string() (string, error) {
+	length, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	data, err := d.read(int(length) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(data[:length]), nil
+}
+
+func (d *decoder) signature() (string, error) {
+	length, err := d.read(1)
+	if err != nil {
+		return "", err
+	}
+	data, err := d.read(int(length[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(data[:length[0]]), nil
+}
+
+// decodeAll unmarshals the values of a signature holding several complete types
+func (d *decoder) decodeAll(sig string) ([]any, error) {
+	types, err := splitSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, 0, len(types))
+	for _, t := range types {
+		value, err := d.decode(t)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// decode unmarshals a value of a single complete type. Arrays of bytes are
+// returned as []byte, dictionaries as map[string]any keyed by their string or
+// object path keys, structs and other arrays as []any.
+func (d *decoder) decode(sig string) (any, error) {
+	if sig == "" {
+		return nil, fmt.Errorf("empty D-Bus type")
+	}
+	switch sig[0] {
+	case 'v', '(', 'a':
+		if d.depth >= maxNesting {
+			return nil, fmt.Errorf("D-Bus message nests more than %d containers", maxNesting)
+		}
+		d.depth++
+		defer func() { d.depth-- }()
+	}
+
+	switch sig[0] {
+	case 'y':
+		data, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return data[0], nil
+	case 'b':
+		v, err := d.uint32()
+		return v != 0, err
+	case 'u':
+		return d.uint32()
+	case 'i':
+		v, err := d.uint32()
+		return int32(v), err
+	case 's':
+		return d.string()
+	case 'o':
+		s, err := d.string()
+		return ObjectPath(s), err
+	case 'g':
+		return d.signature()
+	case 'v':
+		variantSig, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		if types, err := splitSignature(variantSig); err != nil || len(types) != 1 {
+			return nil, fmt.Errorf("invalid D-Bus variant signature '%s'", variantSig)
+		}
+		value, err := d.decode(variantSig)
+		return Variant{Signature: variantSig, Value: value}, err
+	case '(':
+		if len(sig) < 3 || sig[len(sig)-1] != ')' { // Empty structs are not allowed
+			return nil, fmt.Errorf("invalid D-Bus struct type %s", sig)
+		}
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		return d.decodeAll(sig[1 : len(sig)-1])
+	case 'a':
+		return d.decodeArray(sig[1:])
+	}
+	return nil, fmt.Errorf("unsupported D-Bus type %s", sig)
+}
+
+func (d *decoder) decodeArray(elem string) (any, error) {
+	if elem == "" {
+		return nil, fmt.Errorf("D-Bus array without an element type")
+	}
+	length, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.align(alignment(elem[0])); err != nil {
+		return nil, err
+	}
+	end := d.pos + int(length)
+	if end > len(d.buf) {
+		return nil, errTruncated
+	}
+
+	if elem == "y" {
+		data, _ := d.read(int(length))
+		return data, nil
+	}
+	if elem[0] == '{' {
+		if len(elem) < 2 || elem[len(elem)-1] != '}' {
+			return nil, fmt.Errorf("invalid D-Bus dictionary type a%s", elem)
+		}
+		types, err := splitSignature(elem[1 : len(elem)-1])
+		if err != nil || len(types) != 2 {
+			return nil, fmt.Errorf("invalid D-Bus dictionary type a%s", elem)
+		}
+		entries := map[string]any{}
+		for d.pos < end {
+			if err := d.align(8); err != nil {
+				return nil, err
+			}
+			key, err := d.decode(types[0])
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.decode(types[1])
+			if err != nil {
+				return nil, err
+			}
+			entries[fmt.Sprint(key)] = value
+		}
+		return entries, nil
+	}
+	var values []any
+	for d.pos < end {
+		value, err := d.decode(elem)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// alignment is the alignment of a D-Bus type given its first character
+func alignment(t byte) int {
+	switch t {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 4
+}
+
+// splitSignature splits a signature into its complete types
+func splitSignature(sig string) ([]string, error) {
+	var types []string
+	for len(sig) > 0 {
+		n, err := completeType(sig)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, sig[:n])
+		sig = sig[n:]
+	}
+	return types, nil
+}
+
+// completeType returns the length of the complete type at the start of sig
+func completeType(sig string) (int, error) {
+	switch sig[0] {
+	case 'a':
+		if len(sig) < 2 {
+			return 0, fmt.Errorf("invalid D-Bus signature %s", sig)
+		}
+		n, err := completeType(sig[1:])
+		return n + 1, err
+	case '(', '{':
+		closing := byte(')')
+		if sig[0] == '{' {
+			closing = '}'
+		}
+		for i := 1; i < len(sig); {
+			if sig[i] == closing {
+				return i + 1, nil
+			}
+			n, err := completeType(sig[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+		return 0, fmt.Errorf("invalid D-Bus signature %s", sig)
+	}
+	return 1, nil
+}
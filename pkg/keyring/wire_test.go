@@ -0,0 +1,230 @@
+package keyring
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		sig   string
+		value any
+		want  any
+	}{
+		{"b", true, true},
+		{"u", uint32(42), uint32(42)},
+		{"s", "hello", "hello"},
+		{"o", ObjectPath("/org/freedesktop/secrets"), ObjectPath("/org/freedesktop/secrets")},
+		{"g", "a{sv}", "a{sv}"},
+		{"v", Variant{Signature: "s", Value: "x"}, Variant{Signature: "s", Value: "x"}},
+		{"ay", []byte("secret"), []byte("secret")},
+		{"ao", []ObjectPath{"/a", "/b"}, []any{ObjectPath("/a"), ObjectPath("/b")}},
+		{"a{ss}", map[string]string{"application": "auth-refresher", "registry": "hub"},
+			map[string]any{"application": "auth-refresher", "registry": "hub"}},
+		{"a{sv}",
+			map[string]Variant{
+				"org.freedesktop.Secret.Item.Label":      {Signature: "s", Value: "label"},
+				"org.freedesktop.Secret.Item.Attributes": {Signature: "a{ss}", Value: map[string]string{"k": "v"}},
+			},
+			map[string]any{
+				"org.freedesktop.Secret.Item.Label":      Variant{Signature: "s", Value: "label"},
+				"org.freedesktop.Secret.Item.Attributes": Variant{Signature: "a{ss}", Value: map[string]any{"k": "v"}},
+			}},
+		{"(oayays)",
+			[]any{ObjectPath("/session/1"), []byte{}, []byte("hunter2"), "text/plain"},
+			[]any{ObjectPath("/session/1"), []byte{}, []byte("hunter2"), "text/plain"}},
+		{"a(yv)",
+			[]any{
+				[]any{byte(fieldPath), Variant{Signature: "o", Value: ObjectPath("/x")}},
+				[]any{byte(fieldReplySerial), Variant{Signature: "u", Value: uint32(9)}},
+			},
+			[]any{
+				[]any{byte(fieldPath), Variant{Signature: "o", Value: ObjectPath("/x")}},
+				[]any{byte(fieldReplySerial), Variant{Signature: "u", Value: uint32(9)}},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sig, func(t *testing.T) {
+			// A leading byte makes every value start unaligned, exercising the padding
+			e := &encoder{}
+			if err := e.encode("y", byte(7)); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.encode(tt.sig, tt.value); err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+
+			d := &decoder{buf: e.buf, order: binary.LittleEndian}
+			values, err := d.decodeAll("y" + tt.sig)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(values[1], tt.want) {
+				t.Errorf("got %#v, want %#v", values[1], tt.want)
+			}
+			if d.pos != len(e.buf) {
+				t.Errorf("decoded %d bytes out of %d", d.pos, len(e.buf))
+			}
+		})
+	}
+}
+
+// pipeConns returns two connected ends of an in-memory bus connection
+func pipeConns(t *testing.T) (*conn, *conn) {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		_ = a.Close()
+		_ = b.Close()
+	})
+	noop := func() bool { return true }
+	return &conn{conn: a, reader: bufio.NewReader(a), stop: noop}, &conn{conn: b, reader: bufio.NewReader(b), stop: noop}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	client, server := pipeConns(t)
+	sent := &message{
+		Type:        messageMethodCall,
+		Serial:      3,
+		Path:        "/org/freedesktop/secrets",
+		Interface:   serviceInterface,
+		Member:      "SearchItems",
+		Destination: serviceName,
+		Signature:   "a{ss}u",
+		Body:        []any{map[string]string{"registry": "hub"}, uint32(5)},
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- client.send(sent) }()
+
+	got, err := server.receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	want := *sent
+	want.Body = []any{map[string]any{"registry": "hub"}, uint32(5)}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+}
+
+// bigEndianReply is a method return to serial 3 with the body "hi", in big endian
+var bigEndianReply = []byte{
+	'B', messageMethodReturn, 0, 1,
+	0, 0, 0, 7, // Body length
+	0, 0, 0, 7, // Serial
+	0, 0, 0, 15, // Header fields length
+	fieldReplySerial, 1, 'u', 0, 0, 0, 0, 3,
+	fieldSignature, 1, 'g', 0, 1, 's', 0,
+	0, // Padding to 8 bytes
+	0, 0, 0, 2, 'h', 'i', 0,
+}
+
+func TestReceiveBigEndian(t *testing.T) {
+	c := &conn{reader: bufio.NewReader(bytes.NewReader(bigEndianReply))}
+	msg, err := c.receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != messageMethodReturn || msg.Serial != 7 || msg.ReplySerial != 3 || msg.Signature != "s" {
+		t.Errorf("unexpected header %+v", msg)
+	}
+	if !reflect.DeepEqual(msg.Body, []any{"hi"}) {
+		t.Errorf("got body %#v", msg.Body)
+	}
+}
+
+func TestReceiveMalformed(t *testing.T) {
+	// Every truncation and single byte corruption of a valid message must fail
+	// cleanly or decode, never panic
+	for n := range len(bigEndianReply) {
+		c := &conn{reader: bufio.NewReader(bytes.NewReader(bigEndianReply[:n]))}
+		if _, err := c.receive(); err == nil {
+			t.Errorf("truncated to %d bytes: expected an error", n)
+		}
+	}
+	for i := range bigEndianReply {
+		for _, b := range []byte{0, 1, 'v', '(', 'a', '{', 0xff} {
+			data := bytes.Clone(bigEndianReply)
+			data[i] = b
+			c := &conn{reader: bufio.NewReader(bytes.NewReader(data))}
+			_, _ = c.receive()
+		}
+	}
+}
+
+func TestDecodeInvalidSignatures(t *testing.T) {
+	tests := []struct {
+		name string
+		sig  string
+		data []byte
+	}{
+		{"empty type", "", nil},
+		{"array without element", "a", []byte{0, 0, 0, 0}},
+		{"empty struct", "()", nil},
+		{"unterminated struct", "(s", nil},
+		{"empty variant signature", "v", []byte{0, 0}},
+		{"variant with two types", "v", []byte{2, 's', 's', 0}},
+		{"unterminated dictionary", "a{ss", []byte{0, 0, 0, 0}},
+		{"truncated string", "s", []byte{9, 0, 0, 0, 'x'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &decoder{buf: tt.data, order: binary.LittleEndian}
+			if _, err := d.decode(tt.sig); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// nestedVariants returns n variants nested in each other around a uint32
+func nestedVariants(n int) []byte {
+	data := bytes.Repeat([]byte{1, 'v', 0}, n)
+	data = append(data, 1, 'u', 0)
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+	return append(data, 42, 0, 0, 0)
+}
+
+func TestDecodeNestingLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		depth   int
+		wantErr bool
+	}{
+		{"shallow", 3, false},
+		{"deepest allowed", maxNesting - 1, false},
+		{"too deep", maxNesting, true},
+		{"stack exhausting", 1 << 20, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The decoded variant holds depth more, so maxNesting in all is allowed
+			d := &decoder{buf: nestedVariants(tt.depth), order: binary.LittleEndian}
+			value, err := d.decode("v")
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range tt.depth {
+				value = value.(Variant).Value
+			}
+			if inner := value.(Variant); inner.Signature != "u" || inner.Value != uint32(42) || d.depth != 0 {
+				t.Errorf("got %#v at depth %d", inner, d.depth)
+			}
+		})
+	}
+}
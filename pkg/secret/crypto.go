@@ -0,0 +1,81 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// KeyIterations is the PBKDF2 iteration count used for new keys
+const KeyIterations = 600_000
+
+// SaltSize is the size of the salts generated by NewSalt
+const SaltSize = 16
+
+// keySize is the size of the derived AES-256 keys
+const keySize = 32
+
+// ErrDecrypt is returned when data cannot be decrypted, either because the key
+// (i.e. the passphrase) is wrong or because the data was tampered with
+var ErrDecrypt = errors.New("decryption failed: wrong passphrase or corrupted data")
+
+// NewSalt returns a random salt for DeriveKey
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return salt, nil
+}
+
+// DeriveKey derives an AES-256 key from a passphrase with PBKDF2-HMAC-SHA256
+func DeriveKey(passphrase *Secret, salt []byte, iterations int) (*Secret, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase.Reveal(), salt, iterations, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the key: %w", err)
+	}
+	return New(key), nil
+}
+
+// Encrypt seals plaintext with AES-256-GCM. The random nonce is prepended to
+// the returned ciphertext.
+func Encrypt(key *Secret, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt opens data sealed by Encrypt. The returned plaintext belongs to the caller.
+func Decrypt(key *Secret, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// newGCM returns the AES-GCM cipher of a derived key
+func newGCM(key *Secret) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
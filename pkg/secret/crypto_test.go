@@ -0,0 +1,101 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// PBKDF2-HMAC-SHA256 vectors, the RFC 6070 inputs with SHA-256 as the PRF
+	tests := []struct {
+		passphrase string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1"},
+	}
+	for _, tt := range tests {
+		key, err := DeriveKey(FromString(tt.passphrase), []byte(tt.salt), tt.iterations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(key.Bytes()); got != tt.want {
+			t.Errorf("DeriveKey(%q, %q, %d) = %s, want %s", tt.passphrase, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DeriveKey(FromString("correct horse"), salt, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("hunter2")
+	sealed, err := Encrypt(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Error("the ciphertext holds the plaintext")
+	}
+	again, err := Encrypt(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Error("two encryptions of the same value are identical, the nonce is not random")
+	}
+
+	opened, err := Decrypt(key, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("got %q, want %q", opened, plaintext)
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key, err := DeriveKey(FromString("correct horse"), salt, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey, err := DeriveKey(FromString("battery staple"), salt, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Encrypt(key, []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := map[string]struct {
+		key  *Secret
+		data []byte
+	}{
+		"wrong passphrase": {wrongKey, sealed},
+		"tampered":         {key, tampered},
+		"truncated":        {key, sealed[:5]},
+		"empty":            {key, nil},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decrypt(tt.key, tt.data); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("got %v, want ErrDecrypt", err)
+			}
+		})
+	}
+}
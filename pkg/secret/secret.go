@@ -0,0 +1,93 @@
+// Package secret holds sensitive values such as passwords and tokens. A Secret
+// is redacted whenever it is formatted or encoded, so it cannot leak into error
+// messages or logs, and its buffer can be zeroed once it is not needed anymore.
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// redacted replaces the value of a secret in any formatted output
+const redacted = "[REDACTED]"
+
+// Secret is a sensitive value. The zero value and nil are empty secrets.
+//
+// A secret is zeroed by its owner. Functions returning a secret hand it over to
+// their caller, which becomes its owner, unless they document that they keep
+// it, as a cache does. Functions receiving a secret as an argument only read it.
+type Secret struct {
+	value []byte
+}
+
+// New returns a secret holding value. The secret takes ownership of the slice,
+// which is zeroed along with it.
+func New(value []byte) *Secret {
+	return &Secret{value: value}
+}
+
+// FromString returns a secret holding a copy of value. Go strings cannot be
+// zeroed, so secrets should be built from byte slices whenever possible.
+func FromString(value string) *Secret {
+	return &Secret{value: []byte(value)}
+}
+
+// Clone returns a copy of the secret, which the caller owns
+func (s *Secret) Clone() *Secret {
+	return New(bytes.Clone(s.Bytes()))
+}
+
+// Bytes returns the value of the secret. The slice is zeroed with the secret.
+func (s *Secret) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.value
+}
+
+// Reveal returns the value of the secret as a string, for the APIs that only
+// accept strings. The copy cannot be zeroed, prefer Bytes or Reader.
+func (s *Secret) Reveal() string {
+	return string(s.Bytes())
+}
+
+// Reader returns a reader of the secret value, e.g. to feed it on stdin
+func (s *Secret) Reader() io.Reader {
+	return bytes.NewReader(s.Bytes())
+}
+
+// Empty reports whether the secret has no value
+func (s *Secret) Empty() bool {
+	return len(s.Bytes()) == 0
+}
+
+// Zero overwrites the value of the secret and empties it
+func (s *Secret) Zero() {
+	if s == nil {
+		return
+	}
+	clear(s.value)
+	s.value = nil
+}
+
+// String redacts the secret. The formatting and encoding methods have value
+// receivers, so a Secret held by value is redacted as well as a pointer.
+func (Secret) String() string {
+	return redacted
+}
+
+// GoString redacts the secret, including with %#v
+func (Secret) GoString() string {
+	return redacted
+}
+
+// Format redacts the secret with every verb
+func (Secret) Format(f fmt.State, _ rune) {
+	_, _ = io.WriteString(f, redacted)
+}
+
+// MarshalText redacts the secret in JSON, YAML and any other text encoding
+func (Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
@@ -0,0 +1,58 @@
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRedaction(t *testing.T) {
+	type holder struct {
+		ByValue   Secret
+		ByPointer *Secret
+		Nil       *Secret
+	}
+	h := holder{ByValue: *FromString("hunter2"), ByPointer: FromString("hunter2")}
+
+	outputs := map[string]string{}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x", "%d"} {
+		outputs[format] = fmt.Sprintf(format, h)
+		outputs[format+" value"] = fmt.Sprintf(format, h.ByValue)
+		outputs[format+" pointer"] = fmt.Sprintf(format, h.ByPointer)
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs["json"] = string(data)
+	data, err = yaml.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs["yaml"] = string(data)
+	outputs["error"] = fmt.Errorf("login with %v failed", h.ByPointer).Error()
+
+	for name, output := range outputs {
+		if strings.Contains(output, "hunter2") || strings.Contains(output, "68756e74657232") || !strings.Contains(output, redacted) {
+			t.Errorf("%s leaks the secret: %s", name, output)
+		}
+	}
+}
+
+func TestZero(t *testing.T) {
+	value := []byte("hunter2")
+	s := New(value)
+	s.Zero()
+	if !s.Empty() || string(value) != "\x00\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("got %q after Zero", value)
+	}
+
+	var nilSecret *Secret
+	nilSecret.Zero()
+	if !nilSecret.Empty() || nilSecret.Reveal() != "" {
+		t.Error("a nil secret is empty")
+	}
+}
@@ -3,10 +3,17 @@ package ui
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/manifoldco/promptui"
+	"github.com/mattn/go-isatty"
 )
 
+// promptOutput is where the prompts are drawn. Prompts go to stderr so they never
+// mix with the output of a command, such as the one wrapped by `exec`.
+var promptOutput io.WriteCloser = os.Stderr
+
 // SelectFromList prompts the user to select an item from a list with context support
 func SelectFromList(ctx context.Context, label string, items []string) (string, error) {
 	resultChan := make(chan string, 1)
@@ -14,8 +21,9 @@ func SelectFromList(ctx context.Context, label string, items []string) (string,
 
 	go func() {
 		prompt := promptui.Select{
-			Label: label,
-			Items: items,
+			Label:  label,
+			Items:  items,
+			Stdout: promptOutput,
 			Templates: &promptui.SelectTemplates{
 				Active:   "▶ {{ . | cyan }}", // Highlight the active selection in cyan
 				Inactive: "  {{ . }}",
@@ -45,6 +53,84 @@ func SelectFromList(ctx context.Context, label string, items []string) (string,
 	}
 }
 
+// MultiSelectFromList lets the user toggle any number of items of a list with context support.
+// The selection is returned, in list order, once the user picks the "Done" entry.
+func MultiSelectFromList(ctx context.Context, label string, items []string) ([]string, error) {
+	const done = "✔ Done"
+	selected := make([]bool, len(items))
+	cursor := 1
+
+	for {
+		options := []string{done}
+		for i, item := range items {
+			if selected[i] {
+				options = append(options, "[x] "+item)
+			} else {
+				options = append(options, "[ ] "+item)
+			}
+		}
+
+		index, err := selectIndex(ctx, label, options, cursor)
+		if err != nil {
+			return nil, err
+		}
+		if index == 0 {
+			break
+		}
+		selected[index-1] = !selected[index-1]
+		cursor = index
+	}
+
+	var result []string
+	for i, item := range items {
+		if selected[i] {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// selectIndex shows a select prompt starting at the cursor position and returns the chosen index
+func selectIndex(ctx context.Context, label string, items []string, cursor int) (int, error) {
+	resultChan := make(chan int, 1)
+	errorChan := make(chan error, 1)
+
+	go func() {
+		prompt := promptui.Select{
+			Label:  label,
+			Items:  items,
+			Stdout: promptOutput,
+			Templates: &promptui.SelectTemplates{
+				Active:   "▶ {{ . | cyan }}",
+				Inactive: "  {{ . }}",
+				Selected: "  {{ . }}",
+			},
+			CursorPos:    cursor,
+			HideSelected: true,
+		}
+
+		index, _, err := prompt.Run()
+		if err != nil {
+			if err == promptui.ErrInterrupt {
+				errorChan <- fmt.Errorf("operation cancelled by user")
+				return
+			}
+			errorChan <- err
+			return
+		}
+		resultChan <- index
+	}()
+
+	select {
+	case <-ctx.Done():
+		return 0, fmt.Errorf("operation cancelled by user")
+	case result := <-resultChan:
+		return result, nil
+	case err := <-errorChan:
+		return 0, err
+	}
+}
+
 // ConfirmWithContext prompts the user for a yes/no confirmation with context support
 func ConfirmWithContext(ctx context.Context, label string) (bool, error) {
 	resultChan := make(chan bool, 1)
@@ -54,6 +140,7 @@ func ConfirmWithContext(ctx context.Context, label string) (bool, error) {
 		prompt := promptui.Prompt{
 			Label:     label,
 			IsConfirm: true,
+			Stdout:    promptOutput,
 		}
 
 		_, err := prompt.Run()
@@ -89,6 +176,7 @@ func PromptInputWithContext(ctx context.Context, label string, defaultValue stri
 			Label:    label,
 			Default:  defaultValue,
 			Validate: validate,
+			Stdout:   promptOutput,
 		}
 		if mask {
 			prompt.Mask = '*'
@@ -115,3 +203,8 @@ func PromptInputWithContext(ctx context.Context, label string, defaultValue stri
 func PromptInput(ctx context.Context, label string, mask bool) (string, error) {
 	return PromptInputWithContext(ctx, label, "", nil, mask)
 }
+
+// IsInteractive reports whether stdin is attached to a terminal, so prompts can be shown
+func IsInteractive() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}